@@ -0,0 +1,49 @@
+package dashdog
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+)
+
+// sharedAssetDir is the dir in the documents to store the shared resources
+const sharedAssetDir = "_assets"
+
+// assetHashLength is how many hex chars of the content hash are in the file name of a shared resource
+const assetHashLength = 16
+
+// assetExtRegex matches the extensions kept in the file names of the shared resources
+var assetExtRegex = regexp.MustCompile(`^\.[0-9A-Za-z]{1,16}$`)
+
+// assetHash returns the content hash to name the local file of item in the shared dir,
+// it is empty if item is a page, a stylesheet or not downloaded.
+// The stylesheets keep their paths, because the urls in them are rewritten relative to their local files.
+func assetHash(item *fetchItem) string {
+	if item.needPopulate || item.resp.StatusCode() != http.StatusOK || item.isStylesheet() {
+		return ""
+	}
+
+	hash := ""
+	if item.resumed != nil {
+		// the body of a resumed item is not loaded, the hash of the source is in the record
+		hash = item.resumed.Hash
+	} else {
+		hash = contentHash(item.resp.Body())
+	}
+	if len(hash) < assetHashLength {
+		return ""
+	}
+	return hash[:assetHashLength]
+}
+
+// sharedAssetPath returns the local file of item in the shared dir, e.g. _assets/1a2b3c4d5e6f7a8b.js
+func (i fetchItem) sharedAssetPath() string {
+	ext := i.suffix
+	if ext == "" {
+		ext = path.Ext(i.u.Path)
+	}
+	if !assetExtRegex.MatchString(ext) {
+		ext = ""
+	}
+	return sharedAssetDir + "/" + i.assetHash + ext
+}
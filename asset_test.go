@@ -0,0 +1,167 @@
+package dashdog
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSharedAssetPath(t *testing.T) {
+	hash := contentHash([]byte("png"))[:assetHashLength]
+	tests := []struct {
+		name   string
+		url    string
+		suffix string
+		want   string
+	}{
+		{name: "extension", url: "https://example.com/img/logo.png", want: sharedAssetDir + "/" + hash + ".png"},
+		{name: "suffix", url: "https://example.com/widget", suffix: ".html", want: sharedAssetDir + "/" + hash + ".html"},
+		{name: "no extension", url: "https://example.com/font", want: sharedAssetDir + "/" + hash},
+		{name: "query", url: "https://example.com/logo.png?v=1", want: sharedAssetDir + "/" + hash + ".png"},
+		{name: "invalid extension", url: "https://example.com/logo.p-n-g", want: sharedAssetDir + "/" + hash},
+		{name: "long extension", url: "https://example.com/a.abcdefghijklmnopq", want: sharedAssetDir + "/" + hash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := fetchItem{u: mustParseURL(t, tt.url), suffix: tt.suffix, assetHash: hash}
+			if got := item.sharedAssetPath(); got != tt.want {
+				t.Errorf("sharedAssetPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssetHash(t *testing.T) {
+	ok := func(contentType, body string) *response {
+		return &response{statusCode: http.StatusOK, header: http.Header{"Content-Type": {contentType}}, body: []byte(body)}
+	}
+	tests := []struct {
+		name string
+		item *fetchItem
+		want string
+	}{
+		{name: "resource", item: &fetchItem{u: mustParseURL(t, "https://example.com/a.png"), resp: ok("image/png", "png")}, want: contentHash([]byte("png"))[:assetHashLength]},
+		{name: "page", item: &fetchItem{u: mustParseURL(t, "https://example.com/a.html"), needPopulate: true, resp: ok("text/html", "html")}},
+		{name: "stylesheet", item: &fetchItem{u: mustParseURL(t, "https://example.com/a.css"), resp: ok("text/css", "body {}")}},
+		{name: "not found", item: &fetchItem{u: mustParseURL(t, "https://example.com/a.png"), resp: &response{statusCode: http.StatusNotFound}}},
+		{name: "resumed", item: &fetchItem{u: mustParseURL(t, "https://example.com/a.png"), resp: ok("image/png", ""), resumed: &fileRecord{Hash: contentHash([]byte("png"))}}, want: contentHash([]byte("png"))[:assetHashLength]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := assetHash(tt.item); got != tt.want {
+				t.Errorf("assetHash() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharedAssets(t *testing.T) {
+	const logo, bg = "logo", "background"
+	cdn := newTestSite(t, map[string]string{"/logo.png": logo})
+	srv := newTestSite(t, map[string]string{
+		"/docs/": `<html><head><link rel="stylesheet" href="/static/css/app.css"></head><body>
+<img src="logo.png">
+<img src="` + cdn.URL + `/logo.png">
+<a href="pkg/sub/page.html">page</a>
+</body></html>`,
+		"/docs/pkg/sub/page.html": `<html><head><link rel="stylesheet" href="/static/css/app.css"></head><body>
+<img src="../../logo.png">
+<img src="copy.png">
+<img src="` + cdn.URL + `/logo.png#x">
+</body></html>`,
+		"/docs/logo.png":         logo,
+		"/docs/pkg/sub/copy.png": logo,
+		"/static/css/app.css":    `body { background: url(../img/bg.png) }`,
+		"/static/img/bg.png":     bg,
+	})
+	host := mustParseURL(t, srv.URL).Host
+	cdnHost := mustParseURL(t, cdn.URL).Host
+
+	d, err := buildTestDocset(t, Config{URL: srv.URL + "/docs/", Depth: 2, SharedAssets: true, Check: true})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	logoPath := sharedAssetDir + "/" + contentHash([]byte(logo))[:assetHashLength] + ".png"
+	bgPath := sharedAssetDir + "/" + contentHash([]byte(bg))[:assetHashLength] + ".png"
+
+	// every resource of the same content is stored once, the pages and the stylesheets keep their paths
+	files := docsetFiles(t, d)
+	assets := make([]string, 0)
+	for p := range files {
+		if strings.HasPrefix(p, sharedAssetDir+"/") {
+			assets = append(assets, p)
+		}
+	}
+	if len(assets) != 2 || files[logoPath] != logo || files[bgPath] != bg {
+		t.Errorf("the shared assets = %v, want %s and %s", assets, logoPath, bgPath)
+	}
+	for _, p := range []string{host + "/docs/index.html", host + "/docs/pkg/sub/page.html", host + "/static/css/app.css"} {
+		if _, ok := files[p]; !ok {
+			t.Errorf("%s is not downloaded", p)
+		}
+	}
+	for _, p := range []string{host + "/docs/logo.png", host + "/docs/pkg/sub/copy.png", cdnHost + "/logo.png", host + "/static/img/bg.png"} {
+		if _, ok := files[p]; ok {
+			t.Errorf("%s is downloaded besides the shared asset", p)
+		}
+	}
+
+	// the links are relative to the local file linking them
+	tests := []struct {
+		localPath string
+		want      []string
+	}{
+		{
+			localPath: host + "/docs/index.html",
+			want: []string{
+				`<link rel="stylesheet" href="../static/css/app.css"/>`,
+				`<img src="../../` + logoPath + `"/>`,
+				`<a href="pkg/sub/page.html">page</a>`,
+			},
+		},
+		{
+			localPath: host + "/docs/pkg/sub/page.html",
+			want: []string{
+				`<link rel="stylesheet" href="../../../static/css/app.css"/>`,
+				`<img src="../../../../` + logoPath + `"/>`,
+				`<img src="../../../../` + logoPath + `#x"/>`,
+			},
+		},
+		{
+			localPath: host + "/static/css/app.css",
+			want:      []string{`url(../../../` + bgPath + `)`},
+		},
+	}
+	for _, tt := range tests {
+		got := files[tt.localPath]
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s does not contain %s:\n%s", tt.localPath, want, got)
+			}
+		}
+	}
+	// the same shared asset is linked from both the images of the nested page
+	if got := strings.Count(files[host+"/docs/pkg/sub/page.html"], `src="../../../../`+logoPath+`"`); got != 2 {
+		t.Errorf("the nested page links the shared logo %d times, want 2", got)
+	}
+
+	// the manifest records the shared asset once
+	m, err := loadManifest(d.tree.Manifest())
+	if err != nil {
+		t.Fatalf("loadManifest: %v", err)
+	}
+	if m.Files[logoPath] == nil || m.Files[bgPath] == nil {
+		t.Errorf("the shared assets are not in the manifest")
+	}
+	broken, err := CheckDocset(filepath.Join(d.tree.path, "test.docset"))
+	if err != nil {
+		t.Fatalf("CheckDocset: %v", err)
+	}
+	if len(broken) != 0 {
+		t.Errorf("CheckDocset() = %+v", broken)
+	}
+}
@@ -0,0 +1,216 @@
+package dashdog
+
+import (
+	"bufio"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+// netscapeCookie is a line of a Netscape-format cookie file
+type netscapeCookie struct {
+	domain     string
+	subdomains bool
+	path       string
+	secure     bool
+	expires    time.Time // zero for a session cookie
+	name       string
+	value      string
+}
+
+// match reports whether the cookie should be sent to u at now
+func (c netscapeCookie) match(u *url.URL, now time.Time) bool {
+	if c.secure && u.Scheme != "https" {
+		return false
+	}
+	if !c.expires.IsZero() && c.expires.Before(now) {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	domain := strings.TrimPrefix(c.domain, ".")
+	if host != domain && !(c.subdomains && strings.HasSuffix(host, "."+domain)) {
+		return false
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return strings.HasPrefix(path, c.path)
+}
+
+// loadCookieFile loads a Netscape-format cookie file, which is exported by curl, wget and the browser extensions
+func loadCookieFile(path string) ([]netscapeCookie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open %s", path)
+	}
+	defer f.Close()
+
+	cookies := make([]netscapeCookie, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// only the line break is trimmed, the tab before an empty value must be kept
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// the http only cookies are prefixed with `#HttpOnly_`
+		line, _ = strings.CutPrefix(line, "#HttpOnly_")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, errors.Errorf("invalid cookie line %q of %s", line, path)
+		}
+
+		cookie := netscapeCookie{
+			domain:     strings.ToLower(fields[0]),
+			subdomains: strings.EqualFold(fields[1], "TRUE"),
+			path:       fields[2],
+			secure:     strings.EqualFold(fields[3], "TRUE"),
+			name:       fields[5],
+			value:      fields[6],
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cookie expires %q of %s", fields[4], path)
+		}
+		if expires > 0 {
+			cookie.expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Scan %s", path)
+	}
+	return cookies, nil
+}
+
+// authenticator adds the headers and credentials to the requests to the allowed hosts
+type authenticator struct {
+	hosts    []string
+	headers  map[string]string
+	username string
+	password string
+	token    string
+	cookies  []netscapeCookie
+}
+
+// newAuthenticator expands the environment variables in the config,
+// the credentials are only sent to defaultHosts if config.AuthHosts is empty
+func newAuthenticator(config HTTP, defaultHosts []string) (*authenticator, error) {
+	a := &authenticator{
+		hosts:    config.AuthHosts,
+		headers:  make(map[string]string, len(config.Headers)),
+		username: os.ExpandEnv(config.BasicAuth.Username),
+		password: os.ExpandEnv(config.BasicAuth.Password),
+		token:    os.ExpandEnv(config.BearerToken),
+	}
+	if len(a.hosts) == 0 {
+		a.hosts = defaultHosts
+	}
+	for k, v := range config.Headers {
+		a.headers[k] = os.ExpandEnv(v)
+	}
+
+	if config.CookieFile != "" {
+		cookies, err := loadCookieFile(os.ExpandEnv(config.CookieFile))
+		if err != nil {
+			return nil, errors.Wrapf(err, "loadCookieFile")
+		}
+		a.cookies = cookies
+	}
+	return a, nil
+}
+
+// allowed reports whether the credentials can be sent to u
+func (a authenticator) allowed(u *url.URL) bool {
+	return matchHost(a.hosts, u)
+}
+
+// matchHost reports whether the host of u is one of hosts, `*.example.com` matches the subdomains of example.com,
+// example.com itself must be in hosts to match
+func matchHost(hosts []string, u *url.URL) bool {
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if h == host || h == hostname {
+			return true
+		}
+		// only `*.` is a wildcard, `*example.com` must not match evilexample.com
+		if domain, ok := strings.CutPrefix(h, "*."); ok && domain != "" && strings.HasSuffix(hostname, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// install adds the credentials to the requests of client,
+// and removes them from the requests redirected to the hosts not allowed
+func (a authenticator) install(client *resty.Client) {
+	client.OnBeforeRequest(a.apply)
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(a.redirect))
+}
+
+// maxRedirects is how many redirects a request follows at most, the same as net/http
+const maxRedirects = 10
+
+// redirect is called before following a redirect, the headers of the first request have been copied to req.
+// net/http only removes Authorization and Cookie from a request to another domain, the other headers are always copied.
+func (a authenticator) redirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if a.allowed(req.URL) {
+		return nil
+	}
+
+	for k := range a.headers {
+		req.Header.Del(k)
+	}
+	req.Header.Del("Authorization")
+	req.Header.Del("Cookie")
+	return nil
+}
+
+// apply is called before every request
+func (a authenticator) apply(_ *resty.Client, req *resty.Request) error {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return errors.Wrapf(err, "Parse %s", req.URL)
+	}
+	if !a.allowed(u) {
+		return nil
+	}
+
+	for k, v := range a.headers {
+		req.SetHeader(k, v)
+	}
+	if a.username != "" || a.password != "" {
+		req.SetBasicAuth(a.username, a.password)
+	}
+	if a.token != "" {
+		req.SetAuthToken(a.token)
+	}
+
+	// set the header instead of adding the cookies, apply is called again on retry
+	now := time.Now()
+	pairs := make([]string, 0)
+	for _, c := range a.cookies {
+		if c.match(u, now) {
+			pairs = append(pairs, (&http.Cookie{Name: c.name, Value: c.value}).String())
+		}
+	}
+	if len(pairs) > 0 {
+		req.SetHeader("Cookie", strings.Join(pairs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package dashdog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts []string
+		u     string
+		want  bool
+	}{
+		{name: "same host", hosts: []string{"example.com"}, u: "https://example.com/a", want: true},
+		{name: "case insensitive", hosts: []string{"Example.COM"}, u: "https://EXAMPLE.com/a", want: true},
+		{name: "host with port", hosts: []string{"example.com:8080"}, u: "http://example.com:8080/a", want: true},
+		{name: "hostname matches any port", hosts: []string{"example.com"}, u: "http://example.com:8080/a", want: true},
+		{name: "other port", hosts: []string{"example.com:8080"}, u: "http://example.com:9090/a", want: false},
+		{name: "other host", hosts: []string{"example.com"}, u: "https://example.org/a", want: false},
+		{name: "subdomain is not the host", hosts: []string{"example.com"}, u: "https://docs.example.com/a", want: false},
+		{name: "wildcard subdomain", hosts: []string{"*.example.com"}, u: "https://docs.example.com/a", want: true},
+		{name: "wildcard deep subdomain", hosts: []string{"*.example.com"}, u: "https://a.b.example.com/a", want: true},
+		{name: "wildcard does not match the apex", hosts: []string{"*.example.com"}, u: "https://example.com/a", want: false},
+		{name: "wildcard and apex", hosts: []string{"*.example.com", "example.com"}, u: "https://example.com/a", want: true},
+		{name: "wildcard does not match a suffix", hosts: []string{"*.example.com"}, u: "https://evilexample.com/a", want: false},
+		{name: "star without dot is not a wildcard", hosts: []string{"*example.com"}, u: "https://evilexample.com/a", want: false},
+		{name: "star without dot does not match a subdomain", hosts: []string{"*example.com"}, u: "https://docs.example.com/a", want: false},
+		{name: "bare star", hosts: []string{"*."}, u: "https://example.com/a", want: false},
+		{name: "no hosts", hosts: nil, u: "https://example.com/a", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchHost(tt.hosts, mustParseURL(t, tt.u)); got != tt.want {
+				t.Errorf("matchHost(%v, %s) = %v, want %v", tt.hosts, tt.u, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCookieFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []netscapeCookie
+		wantErr bool
+	}{
+		{
+			name: "cookies",
+			content: "# Netscape HTTP Cookie File\n" +
+				"\n" +
+				".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc\n" +
+				"docs.example.com\tFALSE\t/pkg\tTRUE\t2000000000\ttoken\tx=y\n",
+			want: []netscapeCookie{
+				{domain: ".example.com", subdomains: true, path: "/", name: "session", value: "abc"},
+				{domain: "docs.example.com", path: "/pkg", secure: true, expires: time.Unix(2000000000, 0), name: "token", value: "x=y"},
+			},
+		},
+		{
+			name:    "http only",
+			content: "#HttpOnly_Example.com\tFALSE\t/\tFALSE\t0\tsid\t1\n",
+			want:    []netscapeCookie{{domain: "example.com", path: "/", name: "sid", value: "1"}},
+		},
+		{
+			name:    "empty value",
+			content: "example.com\tFALSE\t/\tFALSE\t0\tempty\t\n",
+			want:    []netscapeCookie{{domain: "example.com", path: "/", name: "empty"}},
+		},
+		{name: "comments only", content: "# comment\n\n", want: []netscapeCookie{}},
+		{name: "too few fields", content: "example.com\tFALSE\t/\tFALSE\t0\tname\n", wantErr: true},
+		{name: "space separated", content: "example.com FALSE / FALSE 0 name value\n", wantErr: true},
+		{name: "invalid expires", content: "example.com\tFALSE\t/\tFALSE\tnever\tname\tvalue\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cookies.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			got, err := loadCookieFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadCookieFile() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("loadCookieFile() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("loadCookieFile()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNetscapeCookieMatch(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		cookie netscapeCookie
+		u      string
+		want   bool
+	}{
+		{name: "same domain", cookie: netscapeCookie{domain: "example.com", path: "/"}, u: "https://example.com/a", want: true},
+		{name: "subdomain not allowed", cookie: netscapeCookie{domain: "example.com", path: "/"}, u: "https://docs.example.com/a", want: false},
+		{name: "subdomain allowed", cookie: netscapeCookie{domain: ".example.com", subdomains: true, path: "/"}, u: "https://docs.example.com/a", want: true},
+		{name: "suffix is not a subdomain", cookie: netscapeCookie{domain: ".example.com", subdomains: true, path: "/"}, u: "https://evilexample.com/a", want: false},
+		{name: "path prefix", cookie: netscapeCookie{domain: "example.com", path: "/pkg"}, u: "https://example.com/pkg/a", want: true},
+		{name: "other path", cookie: netscapeCookie{domain: "example.com", path: "/pkg"}, u: "https://example.com/api", want: false},
+		{name: "empty path", cookie: netscapeCookie{domain: "example.com", path: "/"}, u: "https://example.com", want: true},
+		{name: "secure over http", cookie: netscapeCookie{domain: "example.com", path: "/", secure: true}, u: "http://example.com/a", want: false},
+		{name: "secure over https", cookie: netscapeCookie{domain: "example.com", path: "/", secure: true}, u: "https://example.com/a", want: true},
+		{name: "expired", cookie: netscapeCookie{domain: "example.com", path: "/", expires: now.Add(-time.Hour)}, u: "https://example.com/a", want: false},
+		{name: "not expired", cookie: netscapeCookie{domain: "example.com", path: "/", expires: now.Add(time.Hour)}, u: "https://example.com/a", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cookie.match(mustParseURL(t, tt.u), now); got != tt.want {
+				t.Errorf("match(%s) = %v, want %v", tt.u, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorRedirect(t *testing.T) {
+	// the headers received by the last request of each server
+	var cdnHeader, siteHeader http.Header
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnHeader = r.Header.Clone()
+	}))
+	defer cdn.Close()
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siteHeader = r.Header.Clone()
+		switch r.URL.Path {
+		case "/cdn.png":
+			http.Redirect(w, r, cdn.URL+"/x.png", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/final", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+	defer site.Close()
+
+	siteURL := mustParseURL(t, site.URL)
+	auth := &authenticator{
+		hosts:   []string{siteURL.Host},
+		headers: map[string]string{"X-Api-Key": "secret123"},
+		token:   "token123",
+		cookies: []netscapeCookie{{domain: siteURL.Hostname(), path: "/", name: "sid", value: "1"}},
+	}
+	client := resty.New()
+	auth.install(client)
+
+	credentials := []string{"X-Api-Key", "Authorization", "Cookie"}
+
+	t.Run("redirected to another host", func(t *testing.T) {
+		if _, err := client.R().Get(site.URL + "/cdn.png"); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		for _, key := range credentials {
+			if siteHeader.Get(key) == "" {
+				t.Errorf("the site did not receive %s", key)
+			}
+			if v := cdnHeader.Get(key); v != "" {
+				t.Errorf("the cdn received %s: %s", key, v)
+			}
+		}
+	})
+
+	t.Run("redirected on the same host", func(t *testing.T) {
+		if _, err := client.R().Get(site.URL + "/moved"); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		for _, key := range credentials {
+			if siteHeader.Get(key) == "" {
+				t.Errorf("the redirected request did not send %s", key)
+			}
+		}
+	})
+
+	t.Run("requested another host", func(t *testing.T) {
+		if _, err := client.R().Get(cdn.URL + "/y.png"); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		for _, key := range credentials {
+			if v := cdnHeader.Get(key); v != "" {
+				t.Errorf("the cdn received %s: %s", key, v)
+			}
+		}
+	})
+
+	t.Run("too many redirects", func(t *testing.T) {
+		if _, err := client.R().Get(site.URL + "/loop"); err == nil {
+			t.Errorf("Get did not stop the redirect loop")
+		}
+	})
+}
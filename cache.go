@@ -0,0 +1,169 @@
+package dashdog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// cacheEntry is the meta of a cached response, the body is stored in a sibling file
+type cacheEntry struct {
+	URL          string `json:"url"`
+	StatusCode   int    `json:"status_code"`
+	ContentType  string `json:"content_type"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	Location     string `json:"location,omitempty"` // the final url after the redirects
+
+	body []byte
+}
+
+func (e cacheEntry) response() *response {
+	header := http.Header{}
+	if e.ContentType != "" {
+		header.Set("Content-Type", e.ContentType)
+	}
+	if e.ETag != "" {
+		header.Set("ETag", e.ETag)
+	}
+	if e.LastModified != "" {
+		header.Set("Last-Modified", e.LastModified)
+	}
+	r := &response{
+		statusCode: e.StatusCode,
+		status:     fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		header:     header,
+		body:       e.body,
+	}
+	if e.Location != "" {
+		// the location is stored by ourselves, it never fails unless the cache is broken
+		if loc, err := url.Parse(e.Location); err == nil {
+			r.location = loc
+		}
+	}
+	return r
+}
+
+// httpCache stores the responses on disk, keyed by url.
+// Different keys never share a file, so it is safe for concurrent use.
+type httpCache struct {
+	dir     string
+	offline bool
+}
+
+func newHTTPCache(dir string, offline bool) *httpCache {
+	return &httpCache{
+		dir:     os.ExpandEnv(dir),
+		offline: offline,
+	}
+}
+
+// paths returns the meta file and the body file of key
+func (c httpCache) paths(key string) (string, string) {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	base := filepath.Join(c.dir, name[:2], name)
+	return base + ".json", base + ".body"
+}
+
+// load returns nil if key is not cached
+func (c httpCache) load(key string) (*cacheEntry, error) {
+	metaPath, bodyPath := c.paths(key)
+
+	data, err := os.ReadFile(metaPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadFile %s", metaPath)
+	}
+
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", metaPath)
+	}
+	if entry.URL != key {
+		return nil, nil
+	}
+
+	entry.body, err = os.ReadFile(bodyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadFile %s", bodyPath)
+	}
+
+	return entry, nil
+}
+
+// cacheable reports whether a response with statusCode should be stored,
+// a not found resource is stored too, so an offline build sees the same result
+func cacheable(statusCode int) bool {
+	return statusCode == http.StatusOK || statusCode == http.StatusNotFound || statusCode == http.StatusGone
+}
+
+func (c httpCache) store(key string, resp *response) error {
+	metaPath, bodyPath := c.paths(key)
+
+	dirname := filepath.Dir(metaPath)
+	if err := os.MkdirAll(dirname, 0755); err != nil {
+		return errors.Wrapf(err, "MkdirAll %s", dirname)
+	}
+
+	entry := cacheEntry{
+		URL:          key,
+		StatusCode:   resp.StatusCode(),
+		ContentType:  resp.Header().Get("Content-Type"),
+		ETag:         resp.Header().Get("ETag"),
+		LastModified: resp.Header().Get("Last-Modified"),
+	}
+	if resp.location != nil {
+		entry.Location = resp.location.String()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrapf(err, "Marshal %+v", entry)
+	}
+
+	// write the body first, so a meta file always has its body
+	if err := writeFileAtomic(bodyPath, resp.Body()); err != nil {
+		return errors.Wrapf(err, "write body")
+	}
+	if err := writeFileAtomic(metaPath, data); err != nil {
+		return errors.Wrapf(err, "write meta")
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and then renames it to path,
+// so a reader never sees a half written file
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return errors.Wrapf(err, "CreateTemp %s", path)
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "Write %s", tmp)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "Rename %s", tmp)
+	}
+	return nil
+}
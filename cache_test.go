@@ -0,0 +1,263 @@
+package dashdog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+func TestHTTPCacheRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		header   http.Header
+		body     string
+		location string
+	}{
+		{
+			name:   "validators",
+			status: http.StatusOK,
+			header: http.Header{
+				"Content-Type":  {"text/html"},
+				"Etag":          {`"v1"`},
+				"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"},
+			},
+			body: "<html></html>",
+		},
+		{name: "redirected", status: http.StatusOK, header: http.Header{"Content-Type": {"text/css"}}, body: "body {}", location: "https://example.com/final.css"},
+		{name: "not found", status: http.StatusNotFound, header: http.Header{}, body: "not found"},
+		{name: "empty body", status: http.StatusOK, header: http.Header{}, body: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newHTTPCache(t.TempDir(), false)
+			resp := &response{statusCode: tt.status, header: tt.header, body: []byte(tt.body)}
+			if tt.location != "" {
+				resp.location = mustParseURL(t, tt.location)
+			}
+			const key = "https://example.com/a"
+			if err := cache.store(key, resp); err != nil {
+				t.Fatalf("store() err = %v", err)
+			}
+
+			entry, err := cache.load(key)
+			if err != nil {
+				t.Fatalf("load() err = %v", err)
+			}
+			if entry == nil {
+				t.Fatalf("load() = nil")
+			}
+			got := entry.response()
+			if got.StatusCode() != tt.status {
+				t.Errorf("status = %d, want %d", got.StatusCode(), tt.status)
+			}
+			if string(got.Body()) != tt.body {
+				t.Errorf("body = %q, want %q", got.Body(), tt.body)
+			}
+			for _, key := range []string{"Content-Type", "ETag", "Last-Modified"} {
+				if got.Header().Get(key) != tt.header.Get(key) {
+					t.Errorf("%s = %q, want %q", key, got.Header().Get(key), tt.header.Get(key))
+				}
+			}
+			gotLocation := ""
+			if got.location != nil {
+				gotLocation = got.location.String()
+			}
+			if gotLocation != tt.location {
+				t.Errorf("location = %q, want %q", gotLocation, tt.location)
+			}
+		})
+	}
+}
+
+func TestHTTPCacheLoadMissing(t *testing.T) {
+	const key = "https://example.com/a"
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, cache *httpCache)
+	}{
+		{name: "not stored", setup: func(t *testing.T, cache *httpCache) {}},
+		{name: "another key", setup: func(t *testing.T, cache *httpCache) {
+			// the meta file of key holds another url
+			other := &response{statusCode: http.StatusOK, header: http.Header{}, body: []byte("other")}
+			if err := cache.store("https://example.com/b", other); err != nil {
+				t.Fatalf("store: %v", err)
+			}
+			metaPath, _ := cache.paths(key)
+			otherMeta, _ := cache.paths("https://example.com/b")
+			data, err := os.ReadFile(otherMeta)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+				t.Fatalf("MkdirAll: %v", err)
+			}
+			if err := os.WriteFile(metaPath, data, 0644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+		}},
+		{name: "no body", setup: func(t *testing.T, cache *httpCache) {
+			if err := cache.store(key, &response{statusCode: http.StatusOK, header: http.Header{}, body: []byte("a")}); err != nil {
+				t.Fatalf("store: %v", err)
+			}
+			_, bodyPath := cache.paths(key)
+			if err := os.Remove(bodyPath); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newHTTPCache(t.TempDir(), false)
+			tt.setup(t, cache)
+			entry, err := cache.load(key)
+			if err != nil {
+				t.Fatalf("load() err = %v", err)
+			}
+			if entry != nil {
+				t.Errorf("load() = %+v, want nil", entry)
+			}
+		})
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	tests := map[int]bool{
+		http.StatusOK:                  true,
+		http.StatusNotFound:            true,
+		http.StatusGone:                true,
+		http.StatusNotModified:         false,
+		http.StatusFound:               false,
+		http.StatusInternalServerError: false,
+		http.StatusTooManyRequests:     false,
+	}
+	for status, want := range tests {
+		if got := cacheable(status); got != want {
+			t.Errorf("cacheable(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+// countingServer serves the validators of a resource and counts the requests
+type countingServer struct {
+	mu          sync.Mutex
+	requests    map[string]int
+	conditional map[string]int // the requests with a validator
+	body        map[string]string
+}
+
+func newCountingServer(t *testing.T) (*countingServer, *httptest.Server) {
+	s := &countingServer{
+		requests:    map[string]int{},
+		conditional: map[string]int{},
+		body:        map[string]string{"/etag": "etag v1", "/modified": "modified v1", "/plain": "plain", "/error": "error"},
+	}
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests[r.URL.Path]++
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			s.conditional[r.URL.Path]++
+		}
+
+		body := s.body[r.URL.Path]
+		switch r.URL.Path {
+		case "/etag":
+			etag := `"` + body + `"`
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/modified":
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/plain":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func TestFetcherCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		offline  bool
+		warm     bool   // get the url once online before the test
+		change   string // change the body on the server after the warm up
+		wantBody string
+		wantErr  error
+		// the requests and the conditional requests of the test, the warm up excluded
+		wantRequests    int
+		wantConditional int
+	}{
+		{name: "miss", path: "/plain", wantBody: "plain", wantRequests: 1},
+		{name: "etag not modified", path: "/etag", warm: true, wantBody: "etag v1", wantRequests: 1, wantConditional: 1},
+		{name: "last modified not modified", path: "/modified", warm: true, wantBody: "modified v1", wantRequests: 1, wantConditional: 1},
+		{name: "etag modified", path: "/etag", warm: true, change: "etag v2", wantBody: "etag v2", wantRequests: 1, wantConditional: 1},
+		{name: "no validator", path: "/plain", warm: true, wantBody: "plain", wantRequests: 1, wantConditional: 0},
+		{name: "error not stored", path: "/error", warm: true, wantBody: "error", wantRequests: 1, wantConditional: 0},
+		{name: "not found stored", path: "/missing", warm: true, offline: true, wantBody: "404 page not found\n", wantRequests: 0},
+		{name: "offline hit", path: "/etag", warm: true, offline: true, change: "etag v2", wantBody: "etag v1", wantRequests: 0},
+		{name: "offline miss", path: "/plain", offline: true, wantErr: ErrNotCached, wantRequests: 0},
+		{name: "offline error not stored", path: "/error", warm: true, offline: true, wantErr: ErrNotCached, wantRequests: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, srv := newCountingServer(t)
+			dir := t.TempDir()
+			u := mustParseURL(t, srv.URL+tt.path)
+
+			if tt.warm {
+				f := newFetcher(resty.New(), newHTTPCache(dir, false), 1)
+				if _, err := f.get(u); err != nil {
+					t.Fatalf("warm up get() err = %v", err)
+				}
+			}
+			s.mu.Lock()
+			if tt.change != "" {
+				s.body[tt.path] = tt.change
+			}
+			requests, conditional := s.requests[tt.path], s.conditional[tt.path]
+			s.mu.Unlock()
+
+			f := newFetcher(resty.New(), newHTTPCache(dir, tt.offline), 1)
+			resp, err := f.get(u)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("get() err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(resp.Body()) != tt.wantBody {
+				t.Errorf("get() body = %q, want %q", resp.Body(), tt.wantBody)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if got := s.requests[tt.path] - requests; got != tt.wantRequests {
+				t.Errorf("%d requests, want %d", got, tt.wantRequests)
+			}
+			if got := s.conditional[tt.path] - conditional; got != tt.wantConditional {
+				t.Errorf("%d conditional requests, want %d", got, tt.wantConditional)
+			}
+		})
+	}
+}
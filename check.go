@@ -0,0 +1,280 @@
+package dashdog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	css "github.com/andybalholm/cascadia"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// BrokenLink is a local link of a generated page which does not resolve
+type BrokenLink struct {
+	Page   string // the page relative to the Documents dir
+	Link   string // the href/src value
+	Reason string
+}
+
+// linkChecker checks the local links of the html files in a Documents dir
+type linkChecker struct {
+	documents string
+	pages     []string                   // the pages to check relative to documents, every html file if nil
+	anchors   map[string]map[string]bool // the ids and names of the pages, keyed by the path relative to documents
+}
+
+// CheckDocset checks that every local href/src/srcset of the pages in the docset points to an existing file,
+// and every fragment to an existing id or name. The broken links are returned in the order of the pages.
+// Only the pages generated by dashdog are checked if the docset has the manifest, the html files downloaded as resources are kept as is.
+func CheckDocset(docset string) ([]BrokenLink, error) {
+	docset = filepath.Clean(docset)
+	tree := newDocTree(filepath.Dir(docset), strings.TrimSuffix(filepath.Base(docset), ".docset"))
+	info, err := os.Stat(tree.Documents())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Stat %s", tree.Documents())
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("%s is not a dir", tree.Documents())
+	}
+
+	m, err := loadManifest(tree.Manifest())
+	if err != nil {
+		return nil, errors.Wrapf(err, "loadManifest")
+	}
+	var pages []string
+	if m != nil {
+		pages = generatedPages(m.Files)
+	}
+	return newLinkChecker(tree.Documents(), pages).check()
+}
+
+// newLinkChecker returns a checker of pages, every html file in documents is checked if pages is nil
+func newLinkChecker(documents string, pages []string) *linkChecker {
+	return &linkChecker{
+		documents: documents,
+		pages:     pages,
+		anchors:   map[string]map[string]bool{},
+	}
+}
+
+// generatedPages returns the pages and the redirect stubs of files in order
+func generatedPages(files map[string]*fileRecord) []string {
+	pages := make([]string, 0)
+	for localPath, record := range files {
+		if record.Page || record.Alias != "" {
+			pages = append(pages, localPath)
+		}
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+func (c *linkChecker) check() ([]BrokenLink, error) {
+	pages := c.pages
+	if pages == nil {
+		var err error
+		pages, err = c.htmlFiles()
+		if err != nil {
+			return nil, errors.Wrapf(err, "htmlFiles")
+		}
+	}
+
+	broken := make([]BrokenLink, 0)
+	for _, page := range pages {
+		links, err := c.checkPage(page)
+		if err != nil {
+			return nil, errors.Wrapf(err, "checkPage %s", page)
+		}
+		broken = append(broken, links...)
+	}
+	return broken, nil
+}
+
+// htmlFiles returns the html files in documents in the lexical order
+func (c *linkChecker) htmlFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(c.documents, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isHTMLFile(p) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(c.documents, p)
+		if err != nil {
+			return errors.Wrapf(err, "Rel %s", p)
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "WalkDir %s", c.documents)
+	}
+	return files, nil
+}
+
+// checkPage returns the broken links of the page, page is the slash separated path relative to the documents
+func (c *linkChecker) checkPage(page string) ([]BrokenLink, error) {
+	doc, err := c.parse(page)
+	if err != nil {
+		return nil, err
+	}
+
+	broken := make([]BrokenLink, 0)
+	for _, node := range css.MustCompile("*[href],*[src],*[data-src],*[poster],*[srcset],*[data-srcset]").MatchAll(doc) {
+		for _, attr := range node.Attr {
+			vals := make([]string, 0, 1)
+			switch {
+			case attr.Key == "href" || attr.Key == "src" || isAssetAttr(node, attr.Key):
+				vals = append(vals, attr.Val)
+			case srcsetAttrs[attr.Key]:
+				for _, ref := range srcsetRefs(attr.Val) {
+					vals = append(vals, ref.val)
+				}
+			}
+
+			for _, val := range vals {
+				if reason := c.checkLink(page, val); reason != "" {
+					broken = append(broken, BrokenLink{
+						Page:   page,
+						Link:   val,
+						Reason: reason,
+					})
+				}
+			}
+		}
+	}
+	return broken, nil
+}
+
+// checkLink returns why the link in page is broken, it is empty if the link resolves or is not a local link
+func (c *linkChecker) checkLink(page, val string) string {
+	u, err := url.Parse(strings.TrimSpace(val))
+	if err != nil {
+		return "invalid url"
+	}
+	if u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		// online, e.g. http:, mailto:, data: and the dash anchors //dash_ref_...
+		return ""
+	}
+
+	target := page
+	if u.Path != "" {
+		if strings.HasPrefix(u.Path, "/") {
+			// Dash resolves it against the root of the file system, not the docset
+			return "absolute path"
+		}
+		target = path.Join(path.Dir(page), u.Path)
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return "out of the docset"
+		}
+		info, err := os.Stat(filepath.Join(c.documents, filepath.FromSlash(target)))
+		if err != nil {
+			return "file not found"
+		}
+		if info.IsDir() {
+			return "is a dir"
+		}
+	}
+
+	if u.Fragment == "" || !isHTMLFile(target) {
+		return ""
+	}
+	anchors, err := c.anchorsOf(target)
+	if err != nil {
+		slog.Debug("anchorsOf failed", slog.String("page", target), slog.String("err", fmt.Sprintf("%+v", err)))
+		return "fragment not found"
+	}
+	if !anchors[u.Fragment] {
+		return "fragment not found"
+	}
+	return ""
+}
+
+// anchorsOf returns the ids and the names of the `<a>` of page
+func (c *linkChecker) anchorsOf(page string) (map[string]bool, error) {
+	if anchors, ok := c.anchors[page]; ok {
+		return anchors, nil
+	}
+
+	doc, err := c.parse(page)
+	if err != nil {
+		return nil, err
+	}
+	anchors := map[string]bool{}
+	for _, node := range css.MustCompile("*[id]").MatchAll(doc) {
+		anchors[attr(node, "id")] = true
+	}
+	for _, node := range css.MustCompile("a[name]").MatchAll(doc) {
+		anchors[attr(node, "name")] = true
+	}
+	c.anchors[page] = anchors
+	return anchors, nil
+}
+
+func (c *linkChecker) parse(page string) (*html.Node, error) {
+	p := filepath.Join(c.documents, filepath.FromSlash(page))
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadFile %s", p)
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parse html of %s", p)
+	}
+	return doc, nil
+}
+
+func isHTMLFile(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".html" || ext == ".htm"
+}
+
+// WriteCheckReport writes the broken links grouped by page to w
+func WriteCheckReport(w io.Writer, broken []BrokenLink) error {
+	page := ""
+	for _, link := range broken {
+		if link.Page != page {
+			page = link.Page
+			if _, err := fmt.Fprintln(w, page); err != nil {
+				return errors.Wrap(err, "Fprintln")
+			}
+		}
+		if _, err := fmt.Fprintf(w, "    %s: %s\n", link.Link, link.Reason); err != nil {
+			return errors.Wrap(err, "Fprintf")
+		}
+	}
+	return nil
+}
+
+// checkLinks checks the links of the generated docset after the build,
+// it returns ErrBrokenLinks if there is a broken link
+func (d Dash) checkLinks() error {
+	if !d.config.Check {
+		return nil
+	}
+
+	broken, err := newLinkChecker(d.tree.Documents(), generatedPages(d.state.fileRecords())).check()
+	if err != nil {
+		return errors.Wrapf(err, "check")
+	}
+	slog.Debug("check links", slog.Int("broken", len(broken)))
+	// the same report as the check command, it is printed whatever the log level is
+	if err := WriteCheckReport(os.Stderr, broken); err != nil {
+		return errors.Wrapf(err, "WriteCheckReport")
+	}
+	if len(broken) > 0 {
+		return errors.Wrapf(ErrBrokenLinks, "%d broken links", len(broken))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package dashdog
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckLink(t *testing.T) {
+	d := &Dash{tree: newDocTree(t.TempDir(), "test")}
+	documents := d.tree.Documents()
+	writeDocument(t, d, "example.com/docs/a.html", `<html><body><h1 id="top">a</h1><a name="Foo"></a></body></html>`)
+	writeDocument(t, d, "example.com/static/app.css", "body {}")
+	writeDocument(t, d, "example.com/docs/pkg/index.html", "<html></html>")
+
+	tests := []struct {
+		name string
+		page string
+		val  string
+		want string
+	}{
+		{name: "same dir", page: "example.com/docs/b.html", val: "a.html", want: ""},
+		{name: "parent dir", page: "example.com/docs/b.html", val: "../static/app.css", want: ""},
+		{name: "id", page: "example.com/docs/b.html", val: "a.html#top", want: ""},
+		{name: "name of a", page: "example.com/docs/b.html", val: "a.html#Foo", want: ""},
+		{name: "fragment of the page itself", page: "example.com/docs/a.html", val: "#top", want: ""},
+		{name: "query", page: "example.com/docs/b.html", val: "a.html?x=1", want: ""},
+		{name: "escaped", page: "example.com/docs/b.html", val: "../static/app%2Ecss", want: ""},
+		{name: "online", page: "example.com/docs/b.html", val: "https://example.com/docs/missing", want: ""},
+		{name: "scheme relative", page: "example.com/docs/b.html", val: "//example.com/docs/missing", want: ""},
+		{name: "dash anchor", page: "example.com/docs/b.html", val: "//dash_ref_Foo/Func/Foo/0", want: ""},
+		{name: "mailto", page: "example.com/docs/b.html", val: "mailto:a@example.com", want: ""},
+		{name: "missing file", page: "example.com/docs/b.html", val: "missing.html", want: "file not found"},
+		{name: "missing fragment", page: "example.com/docs/b.html", val: "a.html#bar", want: "fragment not found"},
+		{name: "missing fragment of the page itself", page: "example.com/docs/a.html", val: "#bar", want: "fragment not found"},
+		{name: "fragment of a resource", page: "example.com/docs/b.html", val: "../static/app.css#x", want: ""},
+		{name: "dir", page: "example.com/docs/b.html", val: "pkg", want: "is a dir"},
+		{name: "out of the docset", page: "example.com/docs/b.html", val: "../../../x.html", want: "out of the docset"},
+		{name: "absolute path", page: "example.com/docs/b.html", val: "/docs/a.html", want: "absolute path"},
+		{name: "invalid", page: "example.com/docs/b.html", val: "%zz", want: "invalid url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLinkChecker(documents, nil)
+			if got := c.checkLink(tt.page, tt.val); got != tt.want {
+				t.Errorf("checkLink(%s, %s) = %q, want %q", tt.page, tt.val, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDocset(t *testing.T) {
+	d := &Dash{tree: newDocTree(t.TempDir(), "test")}
+	writeDocument(t, d, "example.com/docs/index.html", `<html><body><a href="missing.html">m</a><div data-src="tab-1"></div><img data-src="lazy.png"></body></html>`)
+	// a html file downloaded as a resource is kept as is
+	writeDocument(t, d, "cdn.example.com/widget.html", `<html><body><a href="/docs/example.html">e</a></body></html>`)
+	docset := filepath.Join(d.tree.path, "test.docset")
+
+	want := []BrokenLink{
+		{Page: "example.com/docs/index.html", Link: "missing.html", Reason: "file not found"},
+		{Page: "example.com/docs/index.html", Link: "lazy.png", Reason: "file not found"},
+	}
+	check := func(want []BrokenLink) {
+		t.Helper()
+		broken, err := CheckDocset(docset)
+		if err != nil {
+			t.Fatalf("CheckDocset() err = %v", err)
+		}
+		if len(broken) != len(want) {
+			t.Fatalf("CheckDocset() = %+v, want %+v", broken, want)
+		}
+		for i := range broken {
+			if broken[i] != want[i] {
+				t.Errorf("CheckDocset()[%d] = %+v, want %+v", i, broken[i], want[i])
+			}
+		}
+	}
+
+	// without the manifest every html file is checked
+	check(append([]BrokenLink{{Page: "cdn.example.com/widget.html", Link: "/docs/example.html", Reason: "absolute path"}}, want...))
+
+	m := &manifest{Files: map[string]*fileRecord{
+		"example.com/docs/index.html": {Page: true},
+		"cdn.example.com/widget.html": {},
+	}}
+	if err := saveManifest(d.tree.Manifest(), m); err != nil {
+		t.Fatalf("saveManifest: %v", err)
+	}
+	check(want)
+}
+
+func TestCheckCleanBuild(t *testing.T) {
+	other := newTestSite(t, map[string]string{
+		"/widget": `<html><body><a href="/docs/example.html">e</a><a href="tab-1">t</a></body></html>`,
+	})
+	srv := newTestSite(t, map[string]string{
+		"/docs/": `<html><head><link rel="stylesheet" href="/static/app.css"></head><body>
+<h1 id="top">docs</h1>
+<a href="#top">top</a>
+<a href="sub.html#Sub">sub</a>
+<a href="/docs/">self</a>
+<div class="tabs" data-src="tab-1"><p>tab</p></div>
+<iframe src="` + other.URL + `/widget"></iframe>
+<img srcset="a.png 1x, b.png 2x">
+</body></html>`,
+		"/docs/sub.html":  `<html><body><h2 id="Sub">sub</h2><a href="/docs/#top">back</a></body></html>`,
+		"/static/app.css": `body { background: url(../docs/a.png) }`,
+		"/docs/a.png":     "a",
+		"/docs/b.png":     "b",
+	})
+
+	// the build fails with ErrBrokenLinks if a link is broken
+	d, err := buildTestDocset(t, Config{URL: srv.URL + "/docs/", Depth: 2, Check: true})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	// the same with the check command
+	broken, err := CheckDocset(filepath.Join(d.tree.path, "test.docset"))
+	if err != nil {
+		t.Fatalf("CheckDocset() err = %v", err)
+	}
+	if len(broken) != 0 {
+		t.Errorf("CheckDocset() = %+v, want no broken links", broken)
+	}
+}
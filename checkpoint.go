@@ -0,0 +1,174 @@
+package dashdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// checkpointInterval is how many finished files between two checkpoints
+const checkpointInterval = 50
+
+// checkpoint is the crawl state of an unfinished build, a resumed build continues from it
+type checkpoint struct {
+	ConfigHash string                 `json:"config_hash"`
+	Pending    []string               `json:"pending"` // the urls discovered but not finished
+	Files      map[string]*fileRecord `json:"files"`   // the finished files and the references of the pages, keyed by the local path
+}
+
+// submit queues u to the fetcher, the file finished before the checkpoint will not be fetched again
+func (d *Dash) submit(u *url.URL) *fetchTask {
+	if record := d.resumed[fetchKey(u)]; record != nil {
+		return newResumedTask(u, record)
+	}
+	d.state.addPending(fetchKey(u))
+	return d.fetcher.submit(u)
+}
+
+// newResumedTask returns a finished task of record, the response has no body
+func newResumedTask(u *url.URL, record *fileRecord) *fetchTask {
+	header := http.Header{}
+	header.Set("Content-Type", record.ContentType)
+
+	task := &fetchTask{
+		u: u,
+		resp: &response{
+			statusCode: http.StatusOK,
+			status:     fmt.Sprintf("%d %s", http.StatusOK, http.StatusText(http.StatusOK)),
+			header:     header,
+		},
+		record: record,
+		done:   make(chan struct{}),
+	}
+	close(task.done)
+	return task
+}
+
+// resume records the file of item finished before the checkpoint,
+// the page or the stylesheet is transformed again if its children are not the same as the checkpoint
+func (d *Dash) resume(item *fetchItem) (*fetchItem, error) {
+	record := item.resumed
+	if !record.Page && len(record.Children) == 0 {
+		d.state.addFile(item.localPath(), record)
+		slog.Debug("resume resource", slog.String("localPath", item.localPath()))
+		return item, nil
+	}
+
+	ok, err := d.revisit(record)
+	if err != nil {
+		return nil, errors.Wrapf(err, "revisit %s", item.u.String())
+	}
+	if !ok {
+		slog.Debug("resumed page changed", slog.String("url", item.u.String()))
+		fresh, err := d.newFetchItem(item.u, item.level, true, d.fetcher.submit(item.u))
+		if err != nil {
+			return nil, errors.Wrapf(err, "newFetchItem")
+		}
+		return d.process(fresh)
+	}
+
+	d.state.addFile(item.localPath(), record)
+	for _, ref := range record.Refs {
+		d.state.addRefs(ref.reference())
+	}
+	slog.Debug("resume page", slog.String("localPath", item.localPath()))
+	return item, nil
+}
+
+// loadCheckpoint loads the checkpoint of the previous unfinished build,
+// d.resumed keeps nil if there is no checkpoint or it can not be reused
+func (d *Dash) loadCheckpoint() error {
+	path := d.tree.Checkpoint()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		slog.Info("no checkpoint, build all", slog.String("path", path))
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "ReadFile %s", path)
+	}
+
+	c := &checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return errors.Wrapf(err, "Unmarshal %s", path)
+	}
+	if c.ConfigHash != configHash(d.config) {
+		slog.Info("config changed, build all", slog.String("path", path))
+		return nil
+	}
+
+	d.resumed = make(map[string]*fileRecord, len(c.Files))
+	for localPath, record := range c.Files {
+		if record.Alias != "" {
+			// request the alias again, so it is redirected to the final url
+			continue
+		}
+		// the file may not be written if the build failed on it
+		absPath := filepath.Join(d.tree.Documents(), localPath)
+		if _, err := os.Stat(absPath); err != nil {
+			continue
+		}
+		u, err := url.Parse(record.URL)
+		if err != nil {
+			return errors.Wrapf(err, "Parse %s", record.URL)
+		}
+		d.resumed[fetchKey(u)] = record
+	}
+	d.pending = c.Pending
+	slog.Info("resume", slog.String("path", path), slog.Int("files", len(d.resumed)), slog.Int("pending", len(c.Pending)))
+	return nil
+}
+
+// prefetchPending queues the pending urls of the checkpoint, so they are downloaded before the crawl reaches them
+func (d *Dash) prefetchPending() {
+	for _, str := range d.pending {
+		u, err := url.Parse(str)
+		if err != nil {
+			continue
+		}
+		d.submit(u)
+	}
+}
+
+func (d *Dash) saveCheckpoint() error {
+	c := &checkpoint{
+		ConfigHash: configHash(d.config),
+		Pending:    d.state.pendingURLs(),
+		Files:      d.state.fileRecords(),
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "Marshal checkpoint")
+	}
+
+	path := d.tree.Checkpoint()
+	if err := writeFileAtomic(path, data); err != nil {
+		return errors.Wrapf(err, "writeFileAtomic %s", path)
+	}
+	slog.Debug("save checkpoint", slog.String("path", path), slog.Int("files", len(c.Files)), slog.Int("pending", len(c.Pending)))
+	return nil
+}
+
+// tickCheckpoint saves the checkpoint every checkpointInterval finished files
+func (d *Dash) tickCheckpoint() {
+	if d.state.fileCount()%checkpointInterval != 0 {
+		return
+	}
+	if err := d.saveCheckpoint(); err != nil {
+		slog.Error("saveCheckpoint failed", slog.String("err", fmt.Sprintf("%+v", err)))
+	}
+}
+
+func (d Dash) removeCheckpoint() error {
+	path := d.tree.Checkpoint()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Remove %s", path)
+	}
+	return nil
+}
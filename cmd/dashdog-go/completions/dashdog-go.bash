@@ -4,7 +4,7 @@ _dashdog_go_complete() {
     local cur opts
     cur="${COMP_WORDS[COMP_CWORD]}"
     prev="${COMP_WORDS[COMP_CWORD-1]}"
-    allopts="-p --pkg -c --config --log --path --cfbundle --path-regex --bundle-pattern --bundle-replace -h --help"
+    allopts="-p --pkg -c --config --log --path --cfbundle --path-regex --bundle-pattern --bundle-replace --concurrency -h --help"
     
     if [[ "$cur" = "-"* ]]; then
         opts="$allopts"
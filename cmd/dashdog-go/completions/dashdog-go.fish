@@ -7,4 +7,5 @@ complete -c dashdog-go -r -f -l cfbundle -d 'the bundle of the root page'
 complete -c dashdog-go -r -f -l path-regex -d 'the sub path which match the `pattern` will be able to generate'
 complete -c dashdog-go -r -f -l bundle-pattern -d 'a `pattern` to match the path of the sub module name'
 complete -c dashdog-go -r -f -l bundle-replace -d 'a `replace-pattern` to replace the path which matched by --bundle-pattern flag'
+complete -c dashdog-go -r -f -l concurrency -d 'the number of workers to fetch pages and resources in parallel'
 complete -c dashdog-go -s h -l help -d 'show help'
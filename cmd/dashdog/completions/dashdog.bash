@@ -4,7 +4,7 @@ _dashdog_complete() {
     local cur opts
     cur="${COMP_WORDS[COMP_CWORD]}"
     prev="${COMP_WORDS[COMP_CWORD-1]}"
-    allopts="-c --config --log --path --name --url --cfbundle --path-regex --bundle-pattern --bundle-replace -h --help -v --version"
+    allopts="-c --config --log --path --name --url --cfbundle --path-regex --bundle-pattern --bundle-replace --concurrency --cache-dir --offline --incremental --resume --rate-limit --user-agent --ignore-robots --cookie-file --proxy --ca-cert --client-cert --client-key --timeout --deadline --source-dir --sitemap --scope-host --scope-prefix --exclude-page --exclude-asset --drop-excluded-assets --query-policy --query-key --index-document --strip-trailing-slash --strip-param --meta-refresh --redirect-stubs --keep-going --max-failures --failure-report --check --promote-data-src --shared-assets -h --help -v --version"
     
     if [[ "$cur" = "-"* ]]; then
         opts="$allopts"
@@ -12,14 +12,26 @@ _dashdog_complete() {
         return 0
     fi
 
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=( $(compgen -W "check" -- "${cur}") )
+        return 0
+    fi
+
     case "$prev" in
         --log)
             opts="debug info warn error off"
             COMPREPLY=( $(compgen -W "${opts}" -- "${cur}") )
             ;;
-        --path)
+        --query-policy)
+            opts="drop hash keep"
+            COMPREPLY=( $(compgen -W "${opts}" -- "${cur}") )
+            ;;
+        --path|--cache-dir|--source-dir|check)
             COMPREPLY=( $(compgen -d) )
             ;;
+        --cookie-file|--ca-cert|--client-cert|--client-key|--sitemap|--failure-report)
+            COMPREPLY=( $(compgen -f -- "${cur}") )
+            ;;
     esac
     return 0
 }
@@ -8,5 +8,42 @@ complete -c dashdog -r -f -l cfbundle -d 'the bundle of the root page'
 complete -c dashdog -r -f -l path-regex -d 'the sub path which match the `pattern` will be able to generate'
 complete -c dashdog -r -f -l bundle-pattern -d 'a `pattern` to match the path of the sub module name'
 complete -c dashdog -r -f -l bundle-replace -d 'a `replace-pattern` to replace the path which matched by --bundle-pattern flag'
+complete -c dashdog -r -f -l concurrency -d 'the number of workers to fetch pages and resources in parallel'
+complete -c dashdog -r -F -l cache-dir -d 'the dir to cache the http responses'
+complete -c dashdog -l offline -d 'only use the cached responses, never access the network'
+complete -c dashdog -l incremental -d 'keep the files of the previous build, only regenerate the changed pages'
+complete -c dashdog -l resume -d 'continue from the checkpoint of the previous unfinished build'
+complete -c dashdog -r -f -l rate-limit -d 'the max requests per second to every host'
+complete -c dashdog -r -f -l user-agent -d 'the user-agent header of every request'
+complete -c dashdog -l ignore-robots -d 'crawl the sub pages even if robots.txt disallows'
+complete -c dashdog -r -F -l cookie-file -d 'a Netscape-format cookie file to load'
+complete -c dashdog -r -f -l proxy -d 'the http, https or socks5 proxy url'
+complete -c dashdog -r -F -l ca-cert -d 'the PEM file of a CA certificate to trust'
+complete -c dashdog -r -F -l client-cert -d 'the PEM file of the client certificate for mTLS'
+complete -c dashdog -r -F -l client-key -d 'the PEM file of the client key'
+complete -c dashdog -r -f -l timeout -d 'the timeout of a request'
+complete -c dashdog -r -f -l deadline -d 'the max duration of all the requests of a build'
+complete -c dashdog -r -F -l source-dir -d 'build from the local html files in the dir'
+complete -c dashdog -r -F -l sitemap -d 'the url or the local file of the sitemap.xml to seed the crawl'
+complete -c dashdog -r -f -l scope-host -d 'a host to crawl'
+complete -c dashdog -r -f -l scope-prefix -d 'a path prefix to crawl'
+complete -c dashdog -r -f -l exclude-page -d 'the sub pages whose path match the pattern are not crawled'
+complete -c dashdog -r -f -l exclude-asset -d 'the resources whose path match the pattern are not downloaded'
+complete -c dashdog -l drop-excluded-assets -d 'remove the nodes of the excluded resources'
+complete -c dashdog -r -f -l query-policy -a 'drop hash keep' -d 'how to map the query of a url to the file name'
+complete -c dashdog -r -f -l query-key -d 'a query key to hash into the file name for the keep policy'
+complete -c dashdog -r -f -l index-document -d 'an index document name to remove from the path'
+complete -c dashdog -l strip-trailing-slash -d 'remove the trailing slash of the path'
+complete -c dashdog -r -f -l strip-param -d 'a query key pattern to remove'
+complete -c dashdog -l meta-refresh -d 'follow the meta refresh pages like the http redirects'
+complete -c dashdog -l redirect-stubs -d 'write a redirect stub to the local file of every redirected page'
+complete -c dashdog -l keep-going -d 'record the failed pages and resources and go on'
+complete -c dashdog -r -f -l max-failures -d 'the build fails if there are more failures'
+complete -c dashdog -r -F -l failure-report -d 'the json file to write the failures'
+complete -c dashdog -l check -d 'check the local links of the docset after the build'
+complete -c dashdog -l promote-data-src -d 'set src and srcset to the values of data-src and data-srcset'
+complete -c dashdog -l shared-assets -d 'store every resource once under its content hash in the _assets dir'
+complete -c dashdog -n '__fish_use_subcommand' -a check -d 'check the local links of a docset'
+complete -c dashdog -n '__fish_seen_subcommand_from check' -F
 complete -c dashdog -s h -l help -d 'show help'
 complete -c dashdog -s v -l version -d 'print the version'
@@ -14,6 +14,43 @@ const (
 	flagPathRegex                = "path-regex"
 	flagSubPathBundleNamePattern = "bundle-pattern"
 	flagSubPathBundleNameReplace = "bundle-replace"
+	flagConcurrency              = "concurrency"
+	flagCacheDir                 = "cache-dir"
+	flagOffline                  = "offline"
+	flagIncremental              = "incremental"
+	flagResume                   = "resume"
+	flagRateLimit                = "rate-limit"
+	flagUserAgent                = "user-agent"
+	flagIgnoreRobots             = "ignore-robots"
+	flagCookieFile               = "cookie-file"
+	flagProxy                    = "proxy"
+	flagCACert                   = "ca-cert"
+	flagClientCert               = "client-cert"
+	flagClientKey                = "client-key"
+	flagTimeout                  = "timeout"
+	flagDeadline                 = "deadline"
+	flagSourceDir                = "source-dir"
+	flagSitemap                  = "sitemap"
+	flagScopeHost                = "scope-host"
+	flagScopePrefix              = "scope-prefix"
+	flagExcludePage              = "exclude-page"
+	flagExcludeAsset             = "exclude-asset"
+	flagDropExcludedAssets       = "drop-excluded-assets"
+	flagQueryPolicy              = "query-policy"
+	flagQueryKey                 = "query-key"
+	flagIndexDocument            = "index-document"
+	flagStripTrailingSlash       = "strip-trailing-slash"
+	flagStripParam               = "strip-param"
+	flagMetaRefresh              = "meta-refresh"
+	flagRedirectStubs            = "redirect-stubs"
+	flagKeepGoing                = "keep-going"
+	flagMaxFailures              = "max-failures"
+	flagFailureReport            = "failure-report"
+	flagCheck                    = "check"
+	flagPromoteDataSrc           = "promote-data-src"
+	flagSharedAssets             = "shared-assets"
+
+	commandCheck = "check"
 
 	logOffLevel slog.Level = 16
 
@@ -23,13 +23,19 @@ func main() {
 		UsageText:   "dashdog -c|--config <file> [--log off] [config options]",
 		Version:     version.Version,
 		Description: "",
-		Commands:    []*cli.Command{},
+		Commands: []*cli.Command{
+			{
+				Name:      commandCheck,
+				Usage:     "check the local links of a docset",
+				UsageText: "dashdog check <docset>",
+				Action:    checkAction,
+			},
+		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:      flagConfig,
 				OnlyOnce:  true,
 				Usage:     "the config `file` to load",
-				Required:  true,
 				Aliases:   []string{"c"},
 				TakesFile: true,
 				Validator: func(v string) error {
@@ -104,6 +110,223 @@ func main() {
 				OnlyOnce: true,
 				Usage:    "a `replace-pattern` to replace the path which matched by --bundle-pattern flag, it will overwrite the value of `sub_pattern_bundle_name->replace` item in the config",
 			},
+			&cli.IntFlag{
+				Name:     flagConcurrency,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "the `number` of workers to fetch pages and resources in parallel, at least 1, it will overwrite the value of `concurrency` item in the config",
+				Value:    1,
+			},
+			&cli.StringFlag{
+				Name:      flagCacheDir,
+				Category:  categoryConfig,
+				OnlyOnce:  true,
+				Usage:     "the `dir` to cache the http responses, it will overwrite the value of `cache->dir` item in the config",
+				TakesFile: true,
+			},
+			&cli.BoolFlag{
+				Name:     flagOffline,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "only use the cached responses, never access the network, it will overwrite the value of `cache->offline` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagIncremental,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "keep the files of the previous build, only regenerate the changed pages, it will overwrite the value of `incremental` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagResume,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "continue from the checkpoint of the previous unfinished build, it will overwrite the value of `resume` item in the config",
+			},
+			&cli.FloatFlag{
+				Name:     flagRateLimit,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "the max `requests` per second to every host, 0 means no limit, it will overwrite the value of `rate_limit->requests_per_second` item in the config",
+			},
+			&cli.StringFlag{
+				Name:     flagUserAgent,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "the `user-agent` header of every request, it will overwrite the value of `user_agent` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagIgnoreRobots,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "crawl the sub pages even if robots.txt disallows, it will overwrite the value of `ignore_robots` item in the config",
+			},
+			&cli.StringFlag{
+				Name:      flagCookieFile,
+				Category:  categoryConfig,
+				OnlyOnce:  true,
+				Usage:     "a Netscape-format cookie `file` to load, it will overwrite the value of `http->cookie_file` item in the config",
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:     flagProxy,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "the http, https or socks5 proxy `url`, it will overwrite the value of `http->proxy` item in the config",
+			},
+			&cli.StringSliceFlag{
+				Name:      flagCACert,
+				Category:  categoryConfig,
+				Usage:     "the PEM `file` of a CA certificate to trust besides the system ones, can be set multiple times, it will overwrite the value of `http->ca_certs` item in the config",
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:      flagClientCert,
+				Category:  categoryConfig,
+				OnlyOnce:  true,
+				Usage:     "the PEM `file` of the client certificate for mTLS, it will overwrite the value of `http->client_cert` item in the config",
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:      flagClientKey,
+				Category:  categoryConfig,
+				OnlyOnce:  true,
+				Usage:     "the PEM `file` of the client key, it will overwrite the value of `http->client_key` item in the config",
+				TakesFile: true,
+			},
+			&cli.DurationFlag{
+				Name:     flagTimeout,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "the `timeout` of a request, e.g. 30s, it will overwrite the value of `http->timeout` item in the config",
+			},
+			&cli.DurationFlag{
+				Name:     flagDeadline,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "the max `duration` of all the requests of a build, e.g. 1h, it will overwrite the value of `http->deadline` item in the config",
+			},
+			&cli.StringFlag{
+				Name:      flagSourceDir,
+				Category:  categoryConfig,
+				OnlyOnce:  true,
+				Usage:     "build from the local html files in the `dir`, the url is the seed file in it, it will overwrite the value of `source_dir` item in the config",
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:      flagSitemap,
+				Category:  categoryConfig,
+				OnlyOnce:  true,
+				Usage:     "the url or the local `file` of the sitemap.xml to seed the crawl, it will overwrite the value of `sitemap` item in the config",
+				TakesFile: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     flagScopeHost,
+				Category: categoryConfig,
+				Usage:    "a `host` to crawl, `*.example.com` matches the subdomains, can be set multiple times, it will overwrite the value of `scope->hosts` item in the config",
+			},
+			&cli.StringSliceFlag{
+				Name:     flagScopePrefix,
+				Category: categoryConfig,
+				Usage:    "a path `prefix` to crawl, can be set multiple times, it will overwrite the value of `scope->path_prefixes` item in the config",
+			},
+			&cli.StringSliceFlag{
+				Name:     flagExcludePage,
+				Category: categoryConfig,
+				Usage:    "the sub pages whose path match the `pattern` are not crawled, can be set multiple times, it will overwrite the value of `exclude_path_regex->pages` item in the config",
+			},
+			&cli.StringSliceFlag{
+				Name:     flagExcludeAsset,
+				Category: categoryConfig,
+				Usage:    "the resources whose path match the `pattern` are not downloaded, can be set multiple times, it will overwrite the value of `exclude_path_regex->assets` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagDropExcludedAssets,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "remove the nodes of the excluded resources instead of pointing to the online resources, it will overwrite the value of `exclude_path_regex->drop_assets` item in the config",
+			},
+			&cli.StringFlag{
+				Name:     flagQueryPolicy,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "how to map the query of a url to the file name, available value:[drop,hash,keep], it will overwrite the value of `query->policy` item in the config",
+				Validator: func(v string) error {
+					if v != "" && v != string(dashdog.QueryPolicyDrop) && v != string(dashdog.QueryPolicyHash) && v != string(dashdog.QueryPolicyKeep) {
+						return errors.Errorf("invalid query policy %s", v)
+					}
+					return nil
+				},
+			},
+			&cli.StringSliceFlag{
+				Name:     flagQueryKey,
+				Category: categoryConfig,
+				Usage:    "a query `key` to hash into the file name for the keep policy, can be set multiple times, it will overwrite the value of `query->keys` item in the config",
+			},
+			&cli.StringSliceFlag{
+				Name:     flagIndexDocument,
+				Category: categoryConfig,
+				Usage:    "an index document `name` to remove from the path, e.g. index.html, can be set multiple times, it will overwrite the value of `normalize->index_documents` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagStripTrailingSlash,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "remove the trailing slash of the path, it will overwrite the value of `normalize->strip_trailing_slash` item in the config",
+			},
+			&cli.StringSliceFlag{
+				Name:     flagStripParam,
+				Category: categoryConfig,
+				Usage:    "a query key `pattern` to remove, `*` matches any sequence, e.g. utm_*, can be set multiple times, it will overwrite the value of `normalize->strip_params` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagMetaRefresh,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "follow the meta refresh pages like the http redirects, it will overwrite the value of `redirect->meta_refresh` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagRedirectStubs,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "write a redirect stub to the local file of every redirected page, it will overwrite the value of `redirect->stubs` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagKeepGoing,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "record the failed pages and resources and go on, the links to them point to the online urls, it will overwrite the value of `keep_going->enable` item in the config",
+			},
+			&cli.IntFlag{
+				Name:     flagMaxFailures,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "the build fails after the docset is written if there are more than `number` failures, never fails if it is negative, it will overwrite the value of `keep_going->max_failures` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagCheck,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "check the local links of the docset after the build, the build fails if a link is broken, it will overwrite the value of `check` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagPromoteDataSrc,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "set src and srcset to the values of data-src and data-srcset, so the lazy-loading images render without the javascript, it will overwrite the value of `page->promote_data_src` item in the config",
+			},
+			&cli.BoolFlag{
+				Name:     flagSharedAssets,
+				Category: categoryConfig,
+				OnlyOnce: true,
+				Usage:    "store every resource once under its content hash in the _assets dir, it will overwrite the value of `shared_assets` item in the config",
+			},
+			&cli.StringFlag{
+				Name:      flagFailureReport,
+				Category:  categoryConfig,
+				OnlyOnce:  true,
+				Usage:     "the json `file` to write the failures, it will overwrite the value of `keep_going->report` item in the config",
+				TakesFile: true,
+			},
 		},
 		HideHelp:                   false,
 		HideHelpCommand:            true,
@@ -162,6 +385,25 @@ func action(_ context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+func checkAction(_ context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return errors.Errorf("usage: %s", cmd.UsageText)
+	}
+	docset := cmd.Args().First()
+
+	broken, err := dashdog.CheckDocset(docset)
+	if err != nil {
+		return errors.Wrapf(err, "CheckDocset %s", docset)
+	}
+	if err := dashdog.WriteCheckReport(os.Stdout, broken); err != nil {
+		return errors.Wrapf(err, "WriteCheckReport")
+	}
+	if len(broken) > 0 {
+		return errors.Wrapf(dashdog.ErrBrokenLinks, "%d broken links in %s", len(broken), docset)
+	}
+	return nil
+}
+
 func overwriteConfig(config *dashdog.Config, cmd *cli.Command) {
 	if cmd.IsSet(flagPath) {
 		config.Path = cmd.String(flagPath)
@@ -190,6 +432,111 @@ func overwriteConfig(config *dashdog.Config, cmd *cli.Command) {
 	if cmd.IsSet(flagSubPathBundleNameReplace) {
 		config.SubPathBundleName.Replace = cmd.String(flagSubPathBundleNameReplace)
 	}
+	if cmd.IsSet(flagConcurrency) {
+		config.Concurrency = int(cmd.Int(flagConcurrency))
+	}
+	if cmd.IsSet(flagCacheDir) {
+		config.Cache.Dir = cmd.String(flagCacheDir)
+	}
+	if cmd.IsSet(flagOffline) {
+		config.Cache.Offline = cmd.Bool(flagOffline)
+	}
+	if cmd.IsSet(flagIncremental) {
+		config.Incremental = cmd.Bool(flagIncremental)
+	}
+	if cmd.IsSet(flagResume) {
+		config.Resume = cmd.Bool(flagResume)
+	}
+	if cmd.IsSet(flagRateLimit) {
+		config.RateLimit.RequestsPerSecond = cmd.Float(flagRateLimit)
+	}
+	if cmd.IsSet(flagUserAgent) {
+		config.UserAgent = cmd.String(flagUserAgent)
+	}
+	if cmd.IsSet(flagIgnoreRobots) {
+		config.IgnoreRobots = cmd.Bool(flagIgnoreRobots)
+	}
+	if cmd.IsSet(flagCookieFile) {
+		config.HTTP.CookieFile = cmd.String(flagCookieFile)
+	}
+	if cmd.IsSet(flagProxy) {
+		config.HTTP.Proxy = cmd.String(flagProxy)
+	}
+	if cmd.IsSet(flagCACert) {
+		config.HTTP.CACerts = cmd.StringSlice(flagCACert)
+	}
+	if cmd.IsSet(flagClientCert) {
+		config.HTTP.ClientCert = cmd.String(flagClientCert)
+	}
+	if cmd.IsSet(flagClientKey) {
+		config.HTTP.ClientKey = cmd.String(flagClientKey)
+	}
+	if cmd.IsSet(flagTimeout) {
+		config.HTTP.Timeout = cmd.Duration(flagTimeout)
+	}
+	if cmd.IsSet(flagDeadline) {
+		config.HTTP.Deadline = cmd.Duration(flagDeadline)
+	}
+	if cmd.IsSet(flagSourceDir) {
+		config.SourceDir = cmd.String(flagSourceDir)
+	}
+	if cmd.IsSet(flagSitemap) {
+		config.Sitemap = cmd.String(flagSitemap)
+	}
+	if cmd.IsSet(flagScopeHost) {
+		config.Scope.Hosts = cmd.StringSlice(flagScopeHost)
+	}
+	if cmd.IsSet(flagScopePrefix) {
+		config.Scope.PathPrefixes = cmd.StringSlice(flagScopePrefix)
+	}
+	if cmd.IsSet(flagExcludePage) {
+		config.ExcludePathRegex.Pages = cmd.StringSlice(flagExcludePage)
+	}
+	if cmd.IsSet(flagExcludeAsset) {
+		config.ExcludePathRegex.Assets = cmd.StringSlice(flagExcludeAsset)
+	}
+	if cmd.IsSet(flagDropExcludedAssets) {
+		config.ExcludePathRegex.DropAssets = cmd.Bool(flagDropExcludedAssets)
+	}
+	if cmd.IsSet(flagQueryPolicy) {
+		config.Query.Policy = dashdog.QueryPolicy(cmd.String(flagQueryPolicy))
+	}
+	if cmd.IsSet(flagQueryKey) {
+		config.Query.Keys = cmd.StringSlice(flagQueryKey)
+	}
+	if cmd.IsSet(flagIndexDocument) {
+		config.Normalize.IndexDocuments = cmd.StringSlice(flagIndexDocument)
+	}
+	if cmd.IsSet(flagStripTrailingSlash) {
+		config.Normalize.StripTrailingSlash = cmd.Bool(flagStripTrailingSlash)
+	}
+	if cmd.IsSet(flagStripParam) {
+		config.Normalize.StripParams = cmd.StringSlice(flagStripParam)
+	}
+	if cmd.IsSet(flagMetaRefresh) {
+		config.Redirect.MetaRefresh = cmd.Bool(flagMetaRefresh)
+	}
+	if cmd.IsSet(flagRedirectStubs) {
+		config.Redirect.Stubs = cmd.Bool(flagRedirectStubs)
+	}
+	if cmd.IsSet(flagKeepGoing) {
+		config.KeepGoing.Enable = cmd.Bool(flagKeepGoing)
+	}
+	if cmd.IsSet(flagMaxFailures) {
+		config.KeepGoing.MaxFailures = int(cmd.Int(flagMaxFailures))
+	}
+	if cmd.IsSet(flagFailureReport) {
+		config.KeepGoing.Report = cmd.String(flagFailureReport)
+	}
+	if cmd.IsSet(flagCheck) {
+		config.Check = cmd.Bool(flagCheck)
+	}
+	if cmd.IsSet(flagPromoteDataSrc) {
+		config.Page.PromoteDataSrc = cmd.Bool(flagPromoteDataSrc)
+	}
+	if cmd.IsSet(flagSharedAssets) {
+		config.SharedAssets = cmd.Bool(flagSharedAssets)
+	}
 }
 
 func setLogLevel(cmd *cli.Command) {
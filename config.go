@@ -1,5 +1,7 @@
 package dashdog
 
+import "time"
+
 type IndexNameType int
 
 const (
@@ -47,6 +49,7 @@ type SelectAttr struct {
 type Page struct {
 	RemoveNodeSelector []string     `yaml:"remove_node_selector"`
 	SetAttrs           []SelectAttr `yaml:"set_attrs"`
+	PromoteDataSrc     bool         `yaml:"promote_data_src"` // set src and srcset to the values of data-src and data-srcset, so the lazy-loading images render without the javascript
 }
 
 type SubPathBundleName struct {
@@ -54,6 +57,105 @@ type SubPathBundleName struct {
 	Replace string `yaml:"replace"` // a pattern to replace the source path
 }
 
+type Cache struct {
+	Dir     string `yaml:"dir"`     // the directory to store the http responses, the cache is disabled if it is empty
+	Offline bool   `yaml:"offline"` // only use the cached responses, never access the network
+}
+
+type Retry struct {
+	MaxAttempts int           `yaml:"max_attempts"` // how many times to request a url at most, 1 means never retry
+	BackoffBase time.Duration `yaml:"backoff_base"` // the wait before the first retry, it is doubled for every retry
+	BackoffMax  time.Duration `yaml:"backoff_max"`  // the max wait between two retries, a longer Retry-After header is honoured
+	StatusCodes []int         `yaml:"status_codes"` // the status codes to retry, a network error is always retried
+}
+
+type HostRateLimit struct {
+	RequestsPerSecond float64       `yaml:"requests_per_second"` // the max requests per second, 0 means no limit
+	Burst             int           `yaml:"burst"`               // how many requests can be sent at once, at least 1
+	MinDelay          time.Duration `yaml:"min_delay"`           // the min delay between the start of two requests
+}
+
+type RateLimit struct {
+	HostRateLimit `yaml:",inline"`         // the limit of every host
+	Hosts         map[string]HostRateLimit `yaml:"hosts"` // the limits of the specified hosts, keyed by the host
+}
+
+type BasicAuth struct {
+	Username string `yaml:"username"` // `$VAR` is expanded from the environment
+	Password string `yaml:"password"` // `$VAR` is expanded from the environment
+}
+
+type HTTP struct {
+	Headers     map[string]string `yaml:"headers"`      // the headers of every request, `$VAR` is expanded from the environment
+	BasicAuth   BasicAuth         `yaml:"basic_auth"`   // the basic auth of every request
+	BearerToken string            `yaml:"bearer_token"` // the bearer token of every request, `$VAR` is expanded from the environment
+	CookieFile  string            `yaml:"cookie_file"`  // a Netscape-format cookie file to load
+	AuthHosts   []string          `yaml:"auth_hosts"`   // the hosts to send the headers and credentials, `*.example.com` matches the subdomains, the host of url if empty
+	Proxy       string            `yaml:"proxy"`        // the http, https or socks5 proxy url, HTTP_PROXY/HTTPS_PROXY in the environment are used if empty
+	CACerts     []string          `yaml:"ca_certs"`     // the PEM files of the CA certificates to trust besides the system ones
+	ClientCert  string            `yaml:"client_cert"`  // the PEM file of the client certificate for mTLS
+	ClientKey   string            `yaml:"client_key"`   // the PEM file of the client key, it may be in client_cert if empty
+	Timeout     time.Duration     `yaml:"timeout"`      // the timeout of a request, 0 means no timeout
+	Deadline    time.Duration     `yaml:"deadline"`     // the max duration of all the requests of a build, 0 means no deadline
+}
+
+type Seed struct {
+	URL    string `yaml:"url"`    // the html url to populate
+	Bundle string `yaml:"bundle"` // the bundle name of the pages of the seed, plist->cfbundle_name if empty
+	Depth  int    `yaml:"depth"`  // max depth to process from the seed, depth if 0
+	Index  bool   `yaml:"index"`  // the dashIndexFilePath points to the seed, the first seed if no seed is the index
+}
+
+type Scope struct {
+	Hosts        []string `yaml:"hosts"`         // the hosts to crawl, `*.example.com` matches the subdomains, the hosts of the seeds if empty
+	PathPrefixes []string `yaml:"path_prefixes"` // the path prefixes to crawl, all the paths if empty
+	Include      []string `yaml:"include"`       // only the urls match one of the regexes are crawled, all the urls if empty
+	Exclude      []string `yaml:"exclude"`       // the urls match one of the regexes are never crawled
+}
+
+type ExcludePathRegex struct {
+	Pages      []string `yaml:"pages"`       // the sub pages whose path match one of the regexes are not crawled, the links point to the online pages
+	Assets     []string `yaml:"assets"`      // the resources whose path match one of the regexes are not downloaded
+	DropAssets bool     `yaml:"drop_assets"` // remove the nodes of the excluded resources, or they point to the online resources
+}
+
+type Query struct {
+	Policy QueryPolicy `yaml:"policy"` // how to map the query of a url to the file name: drop, hash or keep, drop if empty
+	Keys   []string    `yaml:"keys"`   // the query keys to hash into the file name for the keep policy
+}
+
+type Normalize struct {
+	LowerHost          bool     `yaml:"lower_host"`           // lower case the host, e.g. Example.COM => example.com
+	RemoveDefaultPort  bool     `yaml:"remove_default_port"`  // remove the port 80 of http and 443 of https
+	LowerPath          bool     `yaml:"lower_path"`           // lower case the path, only for the sites whose path is case insensitive
+	IndexDocuments     []string `yaml:"index_documents"`      // the index documents to remove from the path, e.g. index.html: /pkg/index.html => /pkg/
+	StripTrailingSlash bool     `yaml:"strip_trailing_slash"` // remove the trailing slash of the path, e.g. /pkg/ => /pkg
+	StripParams        []string `yaml:"strip_params"`         // the query keys to remove, `*` matches any sequence, e.g. utm_*
+}
+
+type RewriteRule struct {
+	Pattern  string `yaml:"pattern"`  // a regex matches the whole url
+	Replace  string `yaml:"replace"`  // the replacement of the matched text, `$1` is the first group
+	Unescape bool   `yaml:"unescape"` // query unescape the rewritten url, for the redirect shims like /go?to=https%3A%2F%2Fexample.com%2F
+}
+
+type Redirect struct {
+	MetaRefresh bool `yaml:"meta_refresh"` // follow the `<meta http-equiv=refresh>` pages like the http redirects
+	Stubs       bool `yaml:"stubs"`        // write a redirect stub to the local file of every redirected page, or only the links are rewritten to the final page
+}
+
+type KeepGoing struct {
+	Enable      bool   `yaml:"enable"`       // record the failed pages and resources and go on, the links to them point to the online urls
+	MaxFailures int    `yaml:"max_failures"` // the build fails after the docset is written if there are more failures, never fails if it is negative
+	Report      string `yaml:"report"`       // the json file to write the failures, `$VAR` is expanded from the environment
+}
+
+type LinkPolicy struct {
+	Element string           `yaml:"element"` // the element name of the href/src, e.g. link or iframe, `*` matches every element
+	Rel     string           `yaml:"rel"`     // one of the rels of the element, e.g. canonical, every rel matches if it is empty
+	Action  LinkPolicyAction `yaml:"action"`  // asset: download as a resource; page: crawl as a sub page; embed: populate as a part of the page whatever the depth; online: point to the online url; drop: remove the attr
+}
+
 type Config struct {
 	Path              string            `yaml:"path"`           // The path to generate docset, it will be make if not exist
 	Name              string            `yaml:"name"`           // docset name
@@ -64,4 +166,26 @@ type Config struct {
 	Depth             int               `yaml:"depth"`          // max depth to process
 	SubPathRegex      string            `yaml:"sub_path_regex"` // which sub page will be process if the path match the regex
 	SubPathBundleName SubPathBundleName `yaml:"sub_path_bundle_name"`
+	Concurrency       int               `yaml:"concurrency"`        // how many workers to fetch pages and resources in parallel
+	Cache             Cache             `yaml:"cache"`              // on-disk http cache
+	Incremental       bool              `yaml:"incremental"`        // keep the files of the previous build, only regenerate the changed pages
+	Resume            bool              `yaml:"resume"`             // continue from the checkpoint of the previous unfinished build
+	Retry             Retry             `yaml:"retry"`              // retry the failed requests
+	RateLimit         RateLimit         `yaml:"rate_limit"`         // limit the requests to every host, for pages and resources alike
+	UserAgent         string            `yaml:"user_agent"`         // the User-Agent header of every request
+	IgnoreRobots      bool              `yaml:"ignore_robots"`      // crawl the sub pages even if robots.txt disallows, for the sites we own
+	HTTP              HTTP              `yaml:"http"`               // the headers and credentials of the requests
+	SourceDir         string            `yaml:"source_dir"`         // build from the local html files in the dir instead of a site, url is the seed file in it
+	Sitemap           string            `yaml:"sitemap"`            // the url or the local file of the sitemap.xml or the sitemap index file to seed the crawl
+	URLs              []Seed            `yaml:"urls"`               // more seeds besides url, all the pages are generated in one docset
+	Scope             Scope             `yaml:"scope"`              // which links can be crawled as the sub pages, only the sub paths of a page if empty
+	ExcludePathRegex  ExcludePathRegex  `yaml:"exclude_path_regex"` // the sub pages and resources not to download
+	Query             Query             `yaml:"query"`              // how the query of a url changes the local file
+	Normalize         Normalize         `yaml:"normalize"`          // normalize the urls before downloading and rewriting, so the urls of the same page are downloaded only once
+	Rewrite           []RewriteRule     `yaml:"rewrite"`            // the rules to rewrite every discovered url in order before downloading and rewriting the link
+	Redirect          Redirect          `yaml:"redirect"`           // how to handle the redirected pages, the content is always saved to the local file of the final url
+	KeepGoing         KeepGoing         `yaml:"keep_going"`         // go on building the docset when a page or resource fails
+	Check             bool              `yaml:"check"`              // check the local links of the docset after the build, the build fails if a link is broken
+	LinkPolicies      []LinkPolicy      `yaml:"link_policies"`      // how to handle the href/src of the elements, the first matched policy wins, the default policies are matched after them
+	SharedAssets      bool              `yaml:"shared_assets"`      // store every resource once under its content hash in the _assets dir, the stylesheets and the pages keep their paths
 }
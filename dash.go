@@ -2,6 +2,7 @@ package dashdog
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -27,21 +28,38 @@ type fetchItem struct {
 	level        int
 	needPopulate bool
 	suffix       string
+	queryTag     string   // the tag of the query in the file name, empty if the query is ignored
+	alias        *url.URL // the url requested if it is redirected to u, or nil
+	fetched      *url.URL // the url the content is fetched from, it may not be normalized, the links in the content are resolved against it
+	assetHash    string   // the content hash to name the file in the shared dir, empty if the file is under the host
 
-	resp *resty.Response
+	resp    *response
+	resumed *fileRecord // the file finished before the checkpoint
 }
 
-func newFetchItem(u *url.URL, level int, needPopulate bool, httpClient *resty.Client) (*fetchItem, error) {
+func newFetchItem(u *url.URL, level int, needPopulate bool, task *fetchTask) (*fetchItem, error) {
 	i := &fetchItem{
 		u:            u,
 		level:        level,
 		needPopulate: needPopulate,
 		suffix:       "",
+		fetched:      u,
 	}
 
-	resp, err := httpClient.R().Get(u.String())
+	resp, err := task.wait()
 	if err != nil {
-		return nil, errors.Errorf("head of %s", u.String())
+		return nil, errors.Wrapf(err, "fetch %s", u.String())
+	}
+	if resp.location != nil {
+		i.fetched = resp.location
+	}
+	if loc := resp.location; loc != nil && fetchKey(loc) != fetchKey(u) {
+		// the final url is the only copy of the content, the fragment of the link is kept
+		i.alias = u
+		i.u = &url.URL{}
+		*i.u = *loc
+		i.u.Fragment = u.Fragment
+		i.u.RawFragment = u.RawFragment
 	}
 
 	contentType := resp.Header().Get("Content-Type")
@@ -52,6 +70,7 @@ func newFetchItem(u *url.URL, level int, needPopulate bool, httpClient *resty.Cl
 		i.needPopulate = strings.Contains(contentType, "text/html")
 	}
 	i.resp = resp
+	i.resumed = task.record
 
 	return i, nil
 }
@@ -67,20 +86,38 @@ func (i *fetchItem) adjustSuffix(contentType string) {
 }
 
 func (i fetchItem) localPath() string {
-	if strings.HasSuffix(i.u.Path, i.suffix) {
-		return i.u.Host + i.u.Path
+	if i.assetHash != "" {
+		return i.sharedAssetPath()
+	}
+
+	p := i.u.Path
+	if p == "" || strings.HasSuffix(p, "/") {
+		// the index document of a dir
+		p += "index"
 	}
-	return i.u.Host + i.u.Path + i.suffix
+	p = tagPath(p, i.queryTag)
+	if strings.HasSuffix(p, i.suffix) {
+		return i.u.Host + p
+	}
+	return i.u.Host + p + i.suffix
+}
+
+// localURL returns the link to item in the local file from
+func (i fetchItem) localURL(from string) string {
+	return relativeLink(from, i.localPath(), i.u)
 }
 
-func (i fetchItem) localURL(prefix string) string {
-	cu := *i.u
-	if !strings.HasSuffix(cu.Path, i.suffix) {
-		cu.Path += i.suffix
+func newChildLink(item *fetchItem) childLink {
+	link := childLink{
+		URL:       item.u.String(),
+		LocalPath: item.localPath(),
+		Level:     item.level,
+		Page:      item.needPopulate,
 	}
-	str := cu.String()
-	str, _ = strings.CutPrefix(str, cu.Scheme+":/")
-	return prefix + str
+	if item.alias != nil {
+		link.Alias = item.alias.String()
+	}
+	return link
 }
 
 func (item fetchItem) String() string {
@@ -93,13 +130,26 @@ type Dash struct {
 	httpClient    *resty.Client
 	config        Config
 	indexFilePath string
-	downloaded    map[string]bool
 
-	fetchQueue             []*fetchItem
+	previous               *manifest              // the manifest of the previous build for an incremental build
+	resumed                map[string]*fileRecord // the files finished before the checkpoint, keyed by the url
+	pending                []string               // the pending urls of the checkpoint
+	fetcher                *fetcher
+	limiter                *rateLimiter
+	robots                 *robotsChecker  // nil if robots.txt is ignored
+	crawlSeeds             []crawlSeed     // the seeds of url and urls
+	indexSeed              int             // the index of the seed for dashIndexFilePath
+	seeds                  map[string]bool // the seeds and the pages of the sitemap, keyed by the fetch key
+	scope                  *crawlScope     // nil if the scope is not set
+	excludePageRegexps     []*regexp.Regexp
+	excludeAssetRegexps    []*regexp.Regexp
+	rewriteRules           []rewriteRule
+	linkPolicies           []LinkPolicy // the policies of the config followed by the default ones
 	fetchPathRegex         *regexp.Regexp
 	subPathBundleNameRegex *regexp.Regexp
 
-	refs []*Reference
+	state    *crawlState
+	failures *failures // the failures in the keep going mode
 }
 
 type Reference struct {
@@ -122,22 +172,99 @@ func NewDash(config Config) (*Dash, error) {
 	if config.Depth == 0 {
 		config.Depth = 1
 	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.Retry.MaxAttempts <= 0 {
+		config.Retry.MaxAttempts = 1
+	}
+	if config.Retry.BackoffBase <= 0 {
+		config.Retry.BackoffBase = defaultRetryBackoffBase
+	}
+	if config.Retry.BackoffMax <= 0 {
+		config.Retry.BackoffMax = defaultRetryBackoffMax
+	}
+	if len(config.Retry.StatusCodes) == 0 {
+		config.Retry.StatusCodes = defaultRetryStatusCodes
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = defaultUserAgent
+	}
 	config.Name = strings.ReplaceAll(config.Name, "/", "-")
 
 	d := &Dash{
 		httpClient: resty.New(),
 		tree:       newDocTree(config.Path, config.Name),
 		config:     config,
-		downloaded: map[string]bool{},
+		state:      newCrawlState(),
+		failures:   newFailures(),
+	}
+
+	var cache *httpCache
+	if config.Cache.Dir != "" {
+		cache = newHTTPCache(config.Cache.Dir, config.Cache.Offline)
+	} else if config.Cache.Offline {
+		return nil, errors.New("offline needs a cache dir")
+	}
+	setRetry(d.httpClient, config.Retry)
+	d.httpClient.SetHeader("User-Agent", config.UserAgent)
+	d.limiter = newRateLimiter(config.RateLimit)
+	d.httpClient.OnBeforeRequest(d.limiter.wait)
+
+	crawlSeeds, sourceDir, indexSeed, err := newCrawlSeeds(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "newCrawlSeeds")
+	}
+	d.crawlSeeds = crawlSeeds
+	d.indexSeed = indexSeed
+	d.scope, err = newCrawlScope(config.Scope, crawlSeeds)
+	if err != nil {
+		return nil, errors.Wrapf(err, "newCrawlScope")
+	}
+
+	auth, err := newAuthenticator(config.HTTP, seedHosts(crawlSeeds))
+	if err != nil {
+		return nil, errors.Wrapf(err, "newAuthenticator")
+	}
+	auth.install(d.httpClient)
+	if err := setTransport(d.httpClient, config.HTTP); err != nil {
+		return nil, errors.Wrapf(err, "setTransport")
+	}
+	d.fetcher = newFetcher(d.httpClient, cache, config.Concurrency)
+	d.fetcher.sourceDir = sourceDir
+	d.fetcher.metaRefresh = config.Redirect.MetaRefresh
+	if !config.IgnoreRobots {
+		d.robots = newRobotsChecker(d.fetcher, d.limiter, config.UserAgent)
 	}
 
-	var err error
 	if config.SubPathRegex != "" {
 		d.fetchPathRegex, err = regexp.Compile(config.SubPathRegex)
 		if err != nil {
 			return nil, errors.Wrapf(err, "regexp.Compile SubPathRegex %s", config.SubPathRegex)
 		}
 	}
+	if err := checkQuery(config.Query); err != nil {
+		return nil, errors.Wrapf(err, "checkQuery")
+	}
+	if err := checkNormalize(config.Normalize); err != nil {
+		return nil, errors.Wrapf(err, "checkNormalize")
+	}
+	d.excludePageRegexps, err = compileRegexps(config.ExcludePathRegex.Pages)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compileRegexps ExcludePathRegex.Pages")
+	}
+	d.excludeAssetRegexps, err = compileRegexps(config.ExcludePathRegex.Assets)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compileRegexps ExcludePathRegex.Assets")
+	}
+	if err := checkLinkPolicies(config.LinkPolicies); err != nil {
+		return nil, errors.Wrapf(err, "checkLinkPolicies")
+	}
+	d.linkPolicies = newLinkPolicies(config.LinkPolicies)
+	d.rewriteRules, err = newRewriteRules(config.Rewrite)
+	if err != nil {
+		return nil, errors.Wrapf(err, "newRewriteRules")
+	}
 	if config.SubPathBundleName.Pattern != "" {
 		d.subPathBundleNameRegex, err = regexp.Compile(config.SubPathBundleName.Pattern)
 		if err != nil {
@@ -148,15 +275,29 @@ func NewDash(config Config) (*Dash, error) {
 	return d, nil
 }
 
-func (d *Dash) Build() error {
+func (d *Dash) Build() (err error) {
 	slog.Info("build", slog.String("name", d.config.Name))
 	slog.Debug("build", slog.Any("config", d.config))
 
+	if d.config.Incremental {
+		if err := d.loadPrevious(); err != nil {
+			return errors.Wrapf(err, "loadPrevious")
+		}
+	}
+
+	if d.config.Resume {
+		if err := d.loadCheckpoint(); err != nil {
+			return errors.Wrapf(err, "loadCheckpoint")
+		}
+	}
+
 	// remove old data if exist
-	if err := d.tree.Rm(); err != nil {
-		return errors.Wrapf(err, "rm")
+	if d.previous == nil && d.resumed == nil {
+		if err := d.tree.Rm(); err != nil {
+			return errors.Wrapf(err, "rm")
+		}
+		slog.Debug("remove docpath", slog.String("path", d.tree.Documents()))
 	}
-	slog.Debug("remove docpath", slog.String("path", d.tree.Documents()))
 
 	// Create the docset folder
 	if err := d.tree.Mkdir(); err != nil {
@@ -165,7 +306,7 @@ func (d *Dash) Build() error {
 	slog.Debug("mkdir", slog.String("path", d.tree.Documents()))
 
 	// create sqlite index
-	if err := d.createDB(); err != nil {
+	if err := d.createDB(d.previous != nil); err != nil {
 		return errors.Wrapf(err, "createDB")
 	}
 	slog.Debug("open db", slog.String("path", d.tree.DB()))
@@ -175,18 +316,80 @@ func (d *Dash) Build() error {
 		}
 	}()
 
-	u, err := url.Parse(d.config.URL)
-	if err != nil {
-		return errors.Wrapf(err, "Parse %s", d.config.URL)
+	ctx := context.Background()
+	if d.config.HTTP.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.config.HTTP.Deadline)
+		defer cancel()
 	}
-	slog.Debug("parse url", slog.String("url", d.config.URL))
+	d.fetcher.start(ctx)
+	defer d.fetcher.stop()
 
-	item, err := newFetchItem(u, 0, true, d.httpClient)
+	// save the crawl state, so the next build can resume from it
+	defer func() {
+		if err == nil || errors.Is(err, ErrTooManyFailures) || errors.Is(err, ErrBrokenLinks) {
+			return
+		}
+		if cerr := d.saveCheckpoint(); cerr != nil {
+			slog.Error("saveCheckpoint failed", slog.String("err", fmt.Sprintf("%+v", cerr)))
+		}
+	}()
+	// the robots.txt of the seed hosts are loaded before any page or resource is requested,
+	// so the crawl delay applies from the first request
+	if d.robots != nil {
+		urls := make([]*url.URL, 0, len(d.crawlSeeds))
+		for _, seed := range d.crawlSeeds {
+			urls = append(urls, seed.u)
+		}
+		d.robots.preload(urls)
+	}
+	d.prefetchPending()
+
+	d.seeds = make(map[string]bool, len(d.crawlSeeds))
+	tasks := make([]*fetchTask, 0, len(d.crawlSeeds))
+	for _, seed := range d.crawlSeeds {
+		d.seeds[fetchKey(seed.u)] = true
+		tasks = append(tasks, d.submit(seed.u))
+	}
+	sitemapSeeds, err := d.sitemapSeeds()
 	if err != nil {
-		return errors.Wrapf(err, "newFetchItem %+v", u)
+		return errors.Wrapf(err, "sitemapSeeds")
+	}
+	for _, u := range sitemapSeeds {
+		d.seeds[fetchKey(u)] = true
 	}
 
-	d.indexFilePath = item.localPath()
+	// the item of a failed seed is nil in the keep going mode
+	items := make([]*fetchItem, 0, len(d.crawlSeeds))
+	for i, seed := range d.crawlSeeds {
+		item, err := d.newFetchItem(seed.u, 0, true, tasks[i])
+		if err != nil {
+			if ferr := d.fail(seed.u, nil, nil, err); ferr != nil {
+				return errors.Wrapf(ferr, "newFetchItem %+v", seed.u)
+			}
+			items = append(items, nil)
+			continue
+		}
+		if d.config.KeepGoing.Enable && item.resp.StatusCode() != http.StatusOK {
+			_ = d.fail(item.u, nil, item.resp, errors.Errorf("%s status %s", item.u.String(), item.resp.Status()))
+			items = append(items, nil)
+			continue
+		}
+		items = append(items, item)
+		if item.alias != nil {
+			d.seeds[fetchKey(item.u)] = true
+		}
+	}
+
+	// the first seed succeeded is the index if the index seed failed
+	index := items[d.indexSeed]
+	for i := 0; index == nil && i < len(items); i++ {
+		index = items[i]
+	}
+	if index == nil {
+		return errors.New("all the seeds failed")
+	}
+	d.indexFilePath = index.localPath()
 
 	// create the info.plist
 	if err := d.infoPlist(); err != nil {
@@ -194,9 +397,20 @@ func (d *Dash) Build() error {
 	}
 	slog.Debug("create info.plist", slog.String("path", d.tree.InfoPlist()))
 
-	slog.Debug("popItem", slog.String("item", item.String()))
-	if _, err := d.populateData(item); err != nil {
-		return errors.Wrapf(err, "populateData")
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		slog.Debug("popItem", slog.String("item", item.String()))
+		if _, err := d.populateData(item); err != nil {
+			if ferr := d.fail(item.u, nil, item.resp, err); ferr != nil {
+				return errors.Wrapf(ferr, "populateData")
+			}
+		}
+	}
+
+	if err := d.populateSeeds(sitemapSeeds); err != nil {
+		return errors.Wrapf(err, "populateSeeds")
 	}
 
 	// sort.Slice(d.refs, func(i, j int) bool {
@@ -206,11 +420,63 @@ func (d *Dash) Build() error {
 	// 	return d.refs[i].name < d.refs[j].name
 	// })
 
-	if err := d.insertDB(); err != nil {
-		return errors.Wrapf(err, "insertDB")
+	if d.previous != nil {
+		if err := d.syncDB(); err != nil {
+			return errors.Wrapf(err, "syncDB")
+		}
+		slog.Debug("syncDB", slog.String("path", d.tree.DB()))
+
+		if err := d.prune(); err != nil {
+			return errors.Wrapf(err, "prune")
+		}
+		slog.Debug("prune", slog.String("path", d.tree.Documents()))
+	} else {
+		if err := d.insertDB(); err != nil {
+			return errors.Wrapf(err, "insertDB")
+		}
+		slog.Debug("insertDB", slog.String("path", d.tree.DB()))
+	}
+
+	m := &manifest{
+		ConfigHash: configHash(d.config),
+		Files:      d.state.fileRecords(),
+	}
+	if err := saveManifest(d.tree.Manifest(), m); err != nil {
+		return errors.Wrapf(err, "saveManifest")
+	}
+	slog.Debug("save manifest", slog.String("path", d.tree.Manifest()))
+
+	if err := d.removeCheckpoint(); err != nil {
+		return errors.Wrapf(err, "removeCheckpoint")
+	}
+
+	// the links are checked even if there are too many failures, so both are reported
+	failuresErr := d.reportFailures()
+	checkErr := d.checkLinks()
+	if failuresErr != nil {
+		return errors.Wrapf(failuresErr, "reportFailures")
+	}
+	return errors.Wrapf(checkErr, "checkLinks")
+}
+
+// loadPrevious loads the manifest of the previous build,
+// d.previous keeps nil if the previous files can not be reused
+func (d *Dash) loadPrevious() error {
+	m, err := loadManifest(d.tree.Manifest())
+	if err != nil {
+		return errors.Wrapf(err, "loadManifest")
+	}
+	if m == nil {
+		slog.Info("no previous build, build all", slog.String("path", d.tree.Manifest()))
+		return nil
+	}
+	if m.ConfigHash != configHash(d.config) {
+		slog.Info("config changed, build all", slog.String("path", d.tree.Manifest()))
+		return nil
 	}
-	slog.Debug("insertDB", slog.String("item", item.String()), slog.Int("len(d.refs)", len(d.refs)))
 
+	d.previous = m
+	slog.Debug("load manifest", slog.String("path", d.tree.Manifest()), slog.Int("files", len(m.Files)))
 	return nil
 }
 
@@ -224,14 +490,6 @@ func (d Dash) saveFile(localPath string, body []byte) error {
 	slog.Debug("mkdir", slog.String("path", absPath))
 
 	absPath = filepath.Join(d.tree.Documents(), localPath)
-	_, err = os.Stat(absPath)
-	if err == nil {
-		return nil
-	}
-	if !os.IsNotExist(err) {
-		return errors.Wrapf(err, "Stat file %s", localPath)
-	}
-
 	err = os.WriteFile(absPath, body, 0644)
 	if err != nil {
 		return errors.Wrapf(err, "WriteFile %s", absPath)
@@ -266,7 +524,8 @@ func (d Dash) infoPlist() error {
 	return errors.Wrapf(err, "Execute m:%+v", m)
 }
 
-func (d *Dash) createDB() error {
+// createDB opens the sqlite index, the rows are kept if keep is true
+func (d *Dash) createDB(keep bool) error {
 	dbname := d.tree.DB()
 
 	db, err := sql.Open("sqlite3", dbname)
@@ -284,8 +543,10 @@ func (d *Dash) createDB() error {
 	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS anchor ON searchIndex (name, type, path)`); err != nil {
 		return errors.Wrapf(err, "create unique index")
 	}
-	if _, err := db.Exec(`DELETE FROM searchIndex WHERE 1=1`); err != nil {
-		return errors.Wrapf(err, "delete rows")
+	if !keep {
+		if _, err := db.Exec(`DELETE FROM searchIndex WHERE 1=1`); err != nil {
+			return errors.Wrapf(err, "delete rows")
+		}
 	}
 
 	d.db = db
@@ -293,13 +554,38 @@ func (d *Dash) createDB() error {
 }
 
 func (d *Dash) populateData(item *fetchItem) (*fetchItem, error) {
+	if item.alias != nil {
+		d.state.finish(fetchKey(item.alias))
+		if d.config.Redirect.Stubs {
+			if err := d.writeRedirectStub(item); err != nil {
+				return nil, errors.Wrapf(err, "writeRedirectStub")
+			}
+		}
+	}
+
 	checkPath := item.u.Host + item.u.Path
-	if d.downloaded[checkPath] {
+	if item.queryTag != "" {
+		checkPath += "?" + item.queryTag
+	}
+	if !d.state.markDownloaded(checkPath) {
 		slog.Debug("downloaded", slog.String("path", checkPath))
+		d.state.finish(fetchKey(item.u))
+		if d.failures.failed(item.u) {
+			return nil, errors.Errorf("%s failed before", item.u.String())
+		}
 		return item, nil
 	}
-	d.downloaded[checkPath] = true
 
+	processed, err := d.process(item)
+	if err != nil {
+		return nil, err
+	}
+	d.state.finish(fetchKey(item.u))
+	return processed, nil
+}
+
+// process downloads or populates item, item must be marked as downloaded
+func (d *Dash) process(item *fetchItem) (*fetchItem, error) {
 	urlStr := item.u.String()
 	resp := item.resp
 
@@ -311,12 +597,53 @@ func (d *Dash) populateData(item *fetchItem) (*fetchItem, error) {
 		return nil, errors.Errorf("%s status %s", urlStr, resp.Status())
 	}
 
-	if !item.needPopulate {
+	if item.resumed != nil {
+		return d.resume(item)
+	}
+
+	hash := contentHash(resp.Body())
+	record := &fileRecord{
+		URL:         urlStr,
+		ContentType: resp.Header().Get("Content-Type"),
+		Hash:        hash,
+		Level:       item.level,
+		Page:        item.needPopulate,
+	}
+
+	if !item.needPopulate && !item.isStylesheet() {
+		if !d.state.addFile(item.localPath(), record) {
+			return item, nil
+		}
+		d.tickCheckpoint()
+		if d.unchanged(item, hash) != nil {
+			slog.Debug("unchanged resource", slog.String("localPath", item.localPath()))
+			return item, nil
+		}
 		err := d.saveFile(item.localPath(), resp.Body())
 		slog.Debug("download resource", slog.String("localPath", item.localPath()), slog.String("url", item.u.String()))
 		return item, errors.Wrapf(err, "saveFile")
 	}
 
+	if prev := d.unchanged(item, hash); prev != nil {
+		ok, err := d.revisit(prev)
+		if err != nil {
+			return nil, errors.Wrapf(err, "revisit %s", urlStr)
+		}
+		if ok {
+			slog.Debug("unchanged file", slog.String("localPath", item.localPath()))
+			d.state.addFile(item.localPath(), prev)
+			for _, ref := range prev.Refs {
+				d.state.addRefs(ref.reference())
+			}
+			d.tickCheckpoint()
+			return item, nil
+		}
+	}
+
+	if !item.needPopulate {
+		return d.processStylesheet(item, record)
+	}
+
 	slog.Debug("populateData url", slog.String("url", urlStr))
 
 	u := item.u
@@ -333,8 +660,12 @@ func (d *Dash) populateData(item *fetchItem) (*fetchItem, error) {
 	slog.Debug("removeNode", slog.String("item", item.String()))
 	d.setAttr(doc)
 	slog.Debug("setAttr", slog.String("item", item.String()))
+	if d.config.Page.PromoteDataSrc {
+		d.promoteLazyAttrs(doc)
+		slog.Debug("promoteLazyAttrs", slog.String("item", item.String()))
+	}
 
-	err = d.fetchResource(u, doc, item.level)
+	record.Children, err = d.fetchResource(item, doc)
 	if err != nil {
 		return nil, errors.Wrapf(err, "fetchResource %s", urlStr)
 	}
@@ -343,8 +674,10 @@ func (d *Dash) populateData(item *fetchItem) (*fetchItem, error) {
 	subRefs := d.insertAnchor(u, item.localPath(), doc)
 	slog.Debug("insertAnchor", slog.String("item", item.String()))
 
-	d.insertOnlineRedirection(doc, urlStr)
-	slog.Debug("insertOnlineRedirection", slog.String("url", urlStr))
+	if !isLocal(u) {
+		d.insertOnlineRedirection(doc, urlStr)
+		slog.Debug("insertOnlineRedirection", slog.String("url", urlStr))
+	}
 
 	d.insertLink(doc)
 	slog.Debug("insertLink", slog.String("item", item.String()))
@@ -355,7 +688,7 @@ func (d *Dash) populateData(item *fetchItem) (*fetchItem, error) {
 	}
 	slog.Debug("write html", slog.String("path", item.localPath()))
 
-	bundleName := d.bundleNameOfPath(item.u.Path)
+	bundleName := d.bundleNameOfURL(item.u)
 	pkgRef := &Reference{
 		name:      bundleName,
 		etype:     "Package",
@@ -364,21 +697,36 @@ func (d *Dash) populateData(item *fetchItem) (*fetchItem, error) {
 		anchor:    "",
 	}
 	slog.Debug("insert package", slog.String("name", pkgRef.name), slog.String("type", pkgRef.etype), slog.String("href", pkgRef.href()))
-	d.refs = append(d.refs, pkgRef)
-	d.refs = append(d.refs, subRefs...)
+	d.state.addRefs(pkgRef)
+	d.state.addRefs(subRefs...)
+
+	record.Refs = append(record.Refs, newRefRecord(pkgRef))
+	for _, ref := range subRefs {
+		record.Refs = append(record.Refs, newRefRecord(ref))
+	}
+	d.state.addFile(item.localPath(), record)
+	d.tickCheckpoint()
 
 	return item, nil
 }
 
-func (d Dash) bundleNameOfPath(path string) string {
+// bundleNameOfURL returns the bundle name generated by the sub path bundle name if the path of u matches,
+// or the bundle name of the seed of u, or the bundle name of the docset
+func (d Dash) bundleNameOfURL(u *url.URL) string {
+	defaultName := d.config.Plist.CFBundleName
+	if seed := d.seedOf(u); seed != nil && seed.bundle != "" {
+		defaultName = seed.bundle
+	}
+
+	path := u.Path
 	if path == "" {
-		return d.config.Plist.CFBundleName
+		return defaultName
 	}
 	if d.config.SubPathBundleName.Replace == "" {
-		return d.config.Plist.CFBundleName
+		return defaultName
 	}
 	if !d.subPathBundleNameRegex.MatchString(path) {
-		return d.config.Plist.CFBundleName
+		return defaultName
 	}
 
 	return d.subPathBundleNameRegex.ReplaceAllString(path, d.config.SubPathBundleName.Replace)
@@ -436,102 +784,326 @@ func (d Dash) setAttr(doc *html.Node) {
 	}
 }
 
-func (d *Dash) fetchResource(ourl *url.URL, doc *html.Node, level int) error {
-	slog.Debug("fetchResource", slog.String("url", ourl.String()), slog.Int("level", level))
-	prefix := pathRelativeToRoot(ourl.Path)
+// assetAttrs are the attrs besides href and src whose value is the url of a resource, only on the lazyElements
+var assetAttrs = map[string]bool{
+	"data-src": true,
+	"poster":   true,
+}
+
+// lazyElements are the elements whose data-src and poster are urls,
+// they are the data of the scripts on the other elements, e.g. the tab name of a div
+var lazyElements = map[atom.Atom]bool{
+	atom.Img:    true,
+	atom.Source: true,
+	atom.Video:  true,
+	atom.Audio:  true,
+	atom.Iframe: true,
+}
+
+// isAssetAttr reports whether the attr key of node is the url of a resource besides href and src
+func isAssetAttr(node *html.Node, key string) bool {
+	return assetAttrs[key] && lazyElements[node.DataAtom]
+}
+
+// linkAction indices how to handle a href/src attr
+type linkAction int
+
+const (
+	linkActionOnline   linkAction = iota // set the whole url
+	linkActionSelf                       // the same page, set the relative url
+	linkActionAsset                      // download as a resource, set the relative url
+	linkActionPage                       // populate as a sub page, set the relative url
+	linkActionEmbed                      // populate as a part of the page at the level of the page, set the relative url
+	linkActionDrop                       // remove the node
+	linkActionDropAttr                   // remove the attr
+)
+
+// resourceLink is a href/src attr found in a page
+type resourceLink struct {
+	node   *html.Node
+	index  int // index of the attr in node.Attr
+	u      *url.URL
+	action linkAction
+	task   *fetchTask
+	failed bool // the url failed to rewrite, it is left online
+}
 
-	resourceSelector := css.MustCompile("*[href],*[src]")
+// collectLinks resolves every href/src attr of doc and submits the urls should be downloaded to the fetcher,
+// so that they can be downloaded in parallel before we process them one by one.
+// item is the page of doc, base is the url to resolve the links.
+func (d *Dash) collectLinks(item *fetchItem, base *url.URL, doc *html.Node) ([]*resourceLink, error) {
+	ourl, level := item.u, item.level
+	links := make([]*resourceLink, 0)
+
+	resourceSelector := css.MustCompile("*[href],*[src],*[data-src],*[poster]")
 	nodes := resourceSelector.MatchAll(doc)
 	for _, node := range nodes {
 		for i, attr := range node.Attr {
-			if attr.Key != "href" && attr.Key != "src" {
+			if attr.Key != "href" && attr.Key != "src" && !isAssetAttr(node, attr.Key) {
 				continue
 			}
 
-			u, err := url.Parse(attr.Val)
+			u, ok, err := resolveLink(base, attr.Val)
 			if err != nil {
-				return errors.Wrapf(err, "Parse %s", attr.Val)
+				return nil, errors.Wrapf(err, "resolveLink")
 			}
-
-			if u.Scheme == "" {
-				u.Scheme = ourl.Scheme
+			if !ok {
+				continue
 			}
-			if u.Host == "" {
-				u.Host = ourl.Host
+			rewritten, err := d.rewrite(u)
+			if err != nil {
+				if ferr := d.fail(u, ourl, nil, err); ferr != nil {
+					return nil, errors.Wrapf(ferr, "rewrite")
+				}
+				links = append(links, &resourceLink{node: node, index: i, u: u, action: linkActionOnline, failed: true})
+				continue
 			}
-			if u.Path == "" {
-				u.Path = ourl.Path
+			u = rewritten
+			if !downloadable(u) {
+				continue
 			}
+			u = d.normalize(u)
 
-			// not a atom.A => set a relative url, push to queue
-			// is atom.A
-			//   from a difference site => set the whole url
-			//   from the same site, same url => set the relative url
-			//   from the same site, not a sub page => set the whole url
-			//   from the same site, is a sub page => set the relative url, push to queue
-
-			if node.DataAtom != atom.A {
-				item, err := newFetchItem(u, level, false, d.httpClient)
-				if err != nil {
-					return errors.Wrapf(err, "newFetchItem")
-				}
+			link := &resourceLink{
+				node:  node,
+				index: i,
+				u:     u,
+			}
 
-				if item.resp.StatusCode() == http.StatusNotFound {
-					slog.Error("populateData failed", slog.Any("item", item), slog.String("err", fmt.Sprintf("%+v", err)))
-					node.Parent.RemoveChild(node)
-					break
-				} else if item.resp.StatusCode() != http.StatusOK {
-					return errors.Wrapf(err, "newFetchItem")
+			// the link policy of the element, data-src and poster of the lazy elements are always assets
+			// drop => remove the attr
+			// online => set the whole url
+			// asset => set a relative url, push to queue
+			// embed, e.g. atom.Iframe
+			//   out of the scope => as an asset
+			//   in the scope => as a page, but the depth does not apply
+			// page, e.g. atom.A
+			//   same url => set the relative url
+			//   a seed => set the relative url, push to queue
+			//   out of the scope => set the whole url
+			//   in the scope, is a sub page => set the relative url, push to queue
+			policy := LinkPolicyAsset
+			if !isAssetAttr(node, attr.Key) {
+				policy = d.linkPolicy(node)
+			}
+			if policy == LinkPolicyEmbed && !d.inScope(ourl, u) {
+				// the embedded page of another site is downloaded as is
+				policy = LinkPolicyAsset
+			}
+			asset := policy == LinkPolicyAsset
+			switch {
+			case policy == LinkPolicyDrop:
+				link.action = linkActionDropAttr
+			case policy == LinkPolicyOnline:
+				link.action = linkActionOnline
+			case asset && d.excludedAsset(u):
+				link.action = linkActionOnline
+				if d.config.ExcludePathRegex.DropAssets {
+					link.action = linkActionDrop
 				}
+			case asset:
+				link.action = linkActionAsset
+			case d.isSelf(item, u):
+				link.action = linkActionSelf
+			case d.isSeed(u):
+				link.action = linkActionPage
+			case policy == LinkPolicyEmbed && !d.excludedPage(u) && d.robotsAllowed(u):
+				link.action = linkActionEmbed
+			case !d.inScope(ourl, u):
+				link.action = linkActionOnline
+			case level+1 <= d.depthOf(ourl)-1 && d.pathMatchRegex(u.Path) && !d.excludedPage(u) && d.robotsAllowed(u):
+				link.action = linkActionPage
+			default:
+				link.action = linkActionOnline
+			}
 
-				slog.Debug("process item", slog.String("item", item.String()), slog.Any("node", node), slog.Any("attr", attr))
+			if link.action == linkActionAsset || link.action == linkActionPage || link.action == linkActionEmbed {
+				link.task = d.submit(u)
+			}
+			links = append(links, link)
+		}
+	}
 
-				item, err = d.populateData(item)
-				if err != nil {
-					return errors.Wrapf(err, "populateData")
-				} else {
-					node.Attr[i].Val = item.localURL(prefix)
-				}
+	return links, nil
+}
+
+// isSelf reports whether u is the page of item, or the url redirected to the page
+func (d Dash) isSelf(item *fetchItem, u *url.URL) bool {
+	same := func(page *url.URL) bool {
+		return page.Host == u.Host && page.Path == u.Path && queryTag(d.config.Query, page) == queryTag(d.config.Query, u)
+	}
+	return same(item.u) || (item.alias != nil && same(item.alias))
+}
+
+// fetchResource downloads the resources and sub pages of doc, the page of item, and rewrites the links,
+// it returns the resources and sub pages fetched.
+// The links are resolved against the url the page is fetched from, the normalized url may be another dir, e.g. /pkg/ => /pkg,
+// and they are rewritten relative to the local file of item.
+func (d *Dash) fetchResource(item *fetchItem, doc *html.Node) ([]childLink, error) {
+	ourl, localPath, level := item.u, item.localPath(), item.level
+	slog.Debug("fetchResource", slog.String("url", ourl.String()), slog.Int("level", level))
+
+	base, err := documentBase(item.fetched, doc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "documentBase")
+	}
 
+	links, err := d.collectLinks(item, base, doc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "collectLinks")
+	}
+
+	children := make([]childLink, 0)
+	removed := map[*html.Node]bool{}
+	dropped := make([]*resourceLink, 0)
+	for _, link := range links {
+		node, i, u := link.node, link.index, link.u
+		if removed[node] {
+			continue
+		}
+
+		switch link.action {
+		case linkActionAsset:
+			item, err := d.newFetchItem(u, level, false, link.task)
+			if err != nil {
+				if ferr := d.failLink(link, nil, ourl, err); ferr != nil {
+					return nil, errors.Wrapf(ferr, "newFetchItem")
+				}
+				children = append(children, childLink{URL: u.String(), Failed: true})
 				continue
 			}
 
-			if ourl.Host != u.Host {
-				node.Attr[i].Val = u.String()
+			if item.resp.StatusCode() == http.StatusNotFound {
+				slog.Error("populateData failed", slog.Any("item", item), slog.Int("status", item.resp.StatusCode()))
+				// the missing resource is removed in any mode, it is only recorded in the keep going mode
+				_ = d.fail(item.u, ourl, item.resp, ErrNotFound)
+				d.state.finish(fetchKey(u))
+				if isAssetAttr(node, node.Attr[i].Key) {
+					// the element may have the content or the other sources, only the lazy attr is removed
+					dropped = append(dropped, link)
+					continue
+				}
+				node.Parent.RemoveChild(node)
+				removed[node] = true
+				continue
+			} else if item.resp.StatusCode() != http.StatusOK {
+				if ferr := d.failLink(link, item, ourl, errors.Errorf("%s status %s", u.String(), item.resp.Status())); ferr != nil {
+					return nil, ferr
+				}
+				children = append(children, childLink{URL: u.String(), Failed: true})
 				continue
 			}
 
-			if ourl.Path == u.Path {
-				node.Attr[i].Val = relativeURL(prefix, u, ".html")
+			slog.Debug("process item", slog.String("item", item.String()), slog.Any("node", node), slog.Any("attr", node.Attr[i]))
+
+			processed, err := d.populateData(item)
+			if err != nil {
+				if ferr := d.failLink(link, item, ourl, err); ferr != nil {
+					return nil, errors.Wrapf(ferr, "populateData")
+				}
+				children = append(children, childLink{URL: u.String(), Failed: true})
 				continue
 			}
-
-			if !strings.HasPrefix(u.Path, ourl.Path) {
-				node.Attr[i].Val = u.String()
+			node.Attr[i].Val = processed.localURL(localPath)
+			children = append(children, newChildLink(processed))
+		case linkActionPage, linkActionEmbed:
+			childLevel := level + 1
+			if link.action == linkActionEmbed {
+				// the depth does not apply to the embedded page, it is shown in the page
+				childLevel = level
+			} else if d.isSeed(u) {
+				childLevel = 0
+			}
+			item, err := d.newFetchItem(u, childLevel, true, link.task)
+			if err != nil {
+				if ferr := d.failLink(link, nil, ourl, err); ferr != nil {
+					return nil, errors.Wrapf(ferr, "newFetchItem")
+				}
+				children = append(children, childLink{URL: u.String(), Failed: true})
 				continue
 			}
+			slog.Debug("process item", slog.String("item", item.String()))
 
-			if level+1 <= d.config.Depth-1 && d.pathMatchRegex(u.Path) {
-				item, err := newFetchItem(u, level+1, true, d.httpClient)
-				if err != nil {
-					return errors.Wrapf(err, "newFetchItem")
-				}
-				slog.Debug("process item", slog.String("item", item.String()))
-				item, err = d.populateData(item)
-
-				if err != nil {
-					return errors.Wrapf(err, "populateData")
-				} else {
-					node.Attr[i].Val = item.localURL(prefix)
-					slog.Debug("populateData data succ", slog.Any("item", item), slog.String("attr.val", node.Attr[i].Val))
+			processed, err := d.populateData(item)
+			if err != nil {
+				if ferr := d.failLink(link, item, ourl, err); ferr != nil {
+					return nil, errors.Wrapf(ferr, "populateData")
 				}
-			} else {
-				node.Attr[i].Val = u.String()
+				children = append(children, childLink{URL: u.String(), Failed: true})
+				continue
+			}
+			node.Attr[i].Val = processed.localURL(localPath)
+			slog.Debug("populateData data succ", slog.Any("item", processed), slog.String("attr.val", node.Attr[i].Val))
+			children = append(children, newChildLink(processed))
+		case linkActionDrop:
+			slog.Debug("drop excluded resource", slog.String("url", u.String()))
+			node.Parent.RemoveChild(node)
+			removed[node] = true
+		case linkActionDropAttr:
+			// removed after all the links are handled, so the indices of the attrs of the node do not change
+			dropped = append(dropped, link)
+		case linkActionSelf:
+			node.Attr[i].Val = relativeLink(localPath, localPath, u)
+		default:
+			node.Attr[i].Val = u.String()
+			if link.failed {
+				children = append(children, childLink{URL: u.String(), Failed: true})
 			}
-
 		}
 	}
-	return nil
+
+	// the keys are got before any attr is removed
+	keys := make([]string, 0, len(dropped))
+	for _, link := range dropped {
+		keys = append(keys, link.node.Attr[link.index].Key)
+	}
+	for i, link := range dropped {
+		slog.Debug("drop attr", slog.String("key", keys[i]), slog.String("url", link.u.String()))
+		removeAttr(link.node, keys[i])
+	}
+
+	srcsetChildren, err := d.rewriteSrcsets(ourl, base, localPath, doc, level)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rewriteSrcsets")
+	}
+	children = append(children, srcsetChildren...)
+
+	styleChildren, err := d.rewriteStyles(ourl, base, localPath, doc, level)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rewriteStyles")
+	}
+	children = append(children, styleChildren...)
+	return children, nil
+}
+
+// robotsAllowed reports whether the robots.txt allows us to crawl u, it is always true if robots.txt is ignored
+func (d Dash) robotsAllowed(u *url.URL) bool {
+	if d.robots == nil || isLocal(u) {
+		return true
+	}
+	allowed := d.robots.allowed(u)
+	if !allowed {
+		slog.Info("disallowed by robots.txt", slog.String("url", u.String()))
+	}
+	return allowed
+}
+
+// excludedPage reports whether u should not be crawled as a sub page
+func (d Dash) excludedPage(u *url.URL) bool {
+	re := matchRegexps(d.excludePageRegexps, u.Path)
+	if re != nil {
+		slog.Debug("excluded page", slog.String("url", u.String()), slog.String("pattern", re.String()))
+	}
+	return re != nil
+}
+
+// excludedAsset reports whether u should not be downloaded as a resource
+func (d Dash) excludedAsset(u *url.URL) bool {
+	re := matchRegexps(d.excludeAssetRegexps, u.Path)
+	if re != nil {
+		slog.Debug("excluded resource", slog.String("url", u.String()), slog.String("pattern", re.String()))
+	}
+	return re != nil
 }
 
 func (d Dash) pathMatchRegex(path string) bool {
@@ -590,7 +1162,7 @@ func (d Dash) insertAnchor(u *url.URL, localPath string, doc *html.Node) []*Refe
 
 			if !sel.AnchorOnly {
 				anchor := attr(a, "name")
-				bundle := d.bundleNameOfPath(u.Path)
+				bundle := d.bundleNameOfURL(u)
 				ref := &Reference{
 					name:      name,
 					etype:     sel.Type,
@@ -611,7 +1183,7 @@ func (d Dash) insertAnchor(u *url.URL, localPath string, doc *html.Node) []*Refe
 }
 
 func (d *Dash) insertDB() error {
-	for _, ref := range d.refs {
+	for _, ref := range d.state.references() {
 		_, err := d.db.Exec(`INSERT OR IGNORE INTO searchIndex(name, type, path) VALUES (?,?,?)`, ref.name, ref.etype, ref.href())
 		if err != nil {
 			return errors.Wrapf(err, "insert searchIndex %s %s %s", ref.name, ref.etype, ref.href())
@@ -690,28 +1262,6 @@ func newA(name, etype string, level int) *html.Node {
 	}
 }
 
-func pathRelativeToRoot(path string) string {
-	depth := len(strings.Split(path, "/")) - 1
-
-	parents := make([]string, 0)
-	for i := 0; i < depth; i++ {
-		parents = append(parents, "..")
-	}
-
-	prefix := strings.Join(parents, "/")
-	return prefix
-}
-
-func relativeURL(prefix string, u *url.URL, suffix string) string {
-	cu := *u
-	if !strings.HasSuffix(cu.Path, suffix) {
-		cu.Path += suffix
-	}
-	str := cu.String()
-	str, _ = strings.CutPrefix(str, cu.Scheme+":/")
-	return prefix + str
-}
-
 func localPathOfURL(u *url.URL, suffix string) string {
 	if strings.HasSuffix(u.Path, suffix) {
 		return u.Host + u.Path
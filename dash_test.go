@@ -0,0 +1,298 @@
+package dashdog
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// testSiteHandler serves files keyed by the path, the Content-Type is got from the extension, a path without extension is a html page
+func testSiteHandler(files map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		contentType := mime.TypeByExtension(path.Ext(r.URL.Path))
+		if contentType == "" {
+			contentType = "text/html; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = io.WriteString(w, body)
+	})
+}
+
+func newTestSite(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(testSiteHandler(files))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// buildTestDocset builds a docset of config in a temporary dir if the path is empty
+func buildTestDocset(t *testing.T, config Config) (*Dash, error) {
+	t.Helper()
+	if config.Path == "" {
+		config.Path = t.TempDir()
+	}
+	if config.Name == "" {
+		config.Name = "test"
+	}
+	config.IgnoreRobots = true
+	d, err := NewDash(config)
+	if err != nil {
+		t.Fatalf("NewDash: %v", err)
+	}
+	return d, d.Build()
+}
+
+// readDocument returns the content of a file in the Documents dir of d
+func readDocument(t *testing.T, d *Dash, localPath string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(d.tree.Documents(), localPath))
+	if err != nil {
+		t.Fatalf("ReadFile %s: %v", localPath, err)
+	}
+	return string(data)
+}
+
+func TestLazyAttrs(t *testing.T) {
+	page := `<html><head></head><body>
+<div class="tabs" data-src="tab-1"><p>IMPORTANT CONTENT</p></div>
+<img src="a.png" data-src="missing.png" alt="missing">
+<img src="a.png" data-src="broken.png" alt="broken">
+<video src="v.mp4" poster="poster.png"></video>
+</body></html>`
+	mux := http.NewServeMux()
+	mux.Handle("/", testSiteHandler(map[string]string{
+		"/docs/":           page,
+		"/docs/tab-1":      "<html><body>tab</body></html>",
+		"/docs/a.png":      "png",
+		"/docs/poster.png": "poster",
+		"/docs/v.mp4":      "mp4",
+	}))
+	mux.HandleFunc("/docs/broken.png", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	host := mustParseURL(t, srv.URL).Host
+
+	// the missing data-src is removed, the broken one is left online in the keep going mode
+	d, err := buildTestDocset(t, Config{
+		URL:       srv.URL + "/docs/",
+		KeepGoing: KeepGoing{Enable: true, MaxFailures: -1},
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	got := readDocument(t, d, host+"/docs/index.html")
+	for _, want := range []string{
+		`<div class="tabs" data-src="tab-1"><p>IMPORTANT CONTENT</p></div>`,
+		`<img src="a.png" alt="missing"/>`,
+		`<img src="a.png" data-src="` + srv.URL + `/docs/broken.png" alt="broken"/>`,
+		`<video src="v.mp4" poster="poster.png"></video>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("the page does not contain %s:\n%s", want, got)
+		}
+	}
+	if documentExists(d, host+"/docs/tab-1.html") || documentExists(d, host+"/docs/tab-1") {
+		t.Errorf("the data-src of a div is downloaded")
+	}
+	if !documentExists(d, host+"/docs/poster.png") {
+		t.Errorf("the poster is not downloaded")
+	}
+}
+
+func TestPromoteLazyAttrs(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{name: "img", html: `<img data-src="a.png">`, want: `<img src="a.png"/>`},
+		{name: "img with a placeholder", html: `<img src="blank.gif" data-src="a.png" data-srcset="a.png 1x, b.png 2x">`, want: `<img src="a.png" srcset="a.png 1x, b.png 2x"/>`},
+		{name: "iframe", html: `<iframe data-src="a.html"></iframe>`, want: `<iframe src="a.html"></iframe>`},
+		{name: "div", html: `<div data-src="tab-1">tab</div>`, want: `<div data-src="tab-1">tab</div>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("html.Parse: %v", err)
+			}
+			Dash{}.promoteLazyAttrs(doc)
+
+			var b bytes.Buffer
+			if err := html.Render(&b, doc); err != nil {
+				t.Fatalf("html.Render: %v", err)
+			}
+			if !strings.Contains(b.String(), tt.want) {
+				t.Errorf("promoteLazyAttrs() = %s, want %s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludePathRegex(t *testing.T) {
+	files := map[string]string{
+		"/docs/": `<html><head><link rel="stylesheet" href="app.css"></head><body>
+<a href="a.html">a</a>
+<a href="changelog/v1.html">changelog</a>
+<img src="a.png">
+<video src="intro.mp4"></video>
+<p>text</p>
+</body></html>`,
+		"/docs/a.html":            "<html><body>a</body></html>",
+		"/docs/changelog/v1.html": "<html><body>v1</body></html>",
+		"/docs/app.css":           `body { background: url(bg.mp4) }`,
+		"/docs/a.png":             "png",
+		"/docs/intro.mp4":         "mp4",
+		"/docs/bg.mp4":            "mp4",
+	}
+	var mu sync.Mutex
+	requests := map[string]int{}
+	site := testSiteHandler(files)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		site.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	host := mustParseURL(t, srv.URL).Host
+
+	tests := []struct {
+		name       string
+		dropAssets bool
+		want       []string
+		notWant    []string
+	}{
+		{
+			name: "online",
+			want: []string{
+				`<a href="a.html">a</a>`,
+				`<a href="` + srv.URL + `/docs/changelog/v1.html">changelog</a>`,
+				`<img src="a.png"/>`,
+				`<video src="` + srv.URL + `/docs/intro.mp4"></video>`,
+			},
+		},
+		{
+			name:       "drop assets",
+			dropAssets: true,
+			want: []string{
+				`<a href="a.html">a</a>`,
+				// an excluded page is always online
+				`<a href="` + srv.URL + `/docs/changelog/v1.html">changelog</a>`,
+				`<img src="a.png"/>`,
+				`<p>text</p>`,
+			},
+			notWant: []string{"<video", "intro.mp4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			clear(requests)
+			mu.Unlock()
+
+			d, err := buildTestDocset(t, Config{
+				URL:   srv.URL + "/docs/",
+				Depth: 2,
+				ExcludePathRegex: ExcludePathRegex{
+					Pages:      []string{`^/docs/changelog/`},
+					Assets:     []string{`\.mp4$`},
+					DropAssets: tt.dropAssets,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			got := readDocument(t, d, host+"/docs/index.html")
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("the page does not contain %s:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("the page contains %s:\n%s", notWant, got)
+				}
+			}
+			// the url() of a stylesheet is always kept online, it can not be dropped
+			if css, want := readDocument(t, d, host+"/docs/app.css"), `url(`+srv.URL+`/docs/bg.mp4)`; !strings.Contains(css, want) {
+				t.Errorf("the stylesheet does not contain %s:\n%s", want, css)
+			}
+
+			for _, p := range []string{"/docs/a.html", "/docs/a.png", "/docs/app.css"} {
+				if !documentExists(d, host+p) {
+					t.Errorf("%s is not downloaded", p)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range []string{"/docs/changelog/v1.html", "/docs/intro.mp4", "/docs/bg.mp4"} {
+				if documentExists(d, host+p) || requests[p] > 0 {
+					t.Errorf("%s is requested %d times", p, requests[p])
+				}
+			}
+		})
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	d, err := NewDash(Config{
+		URL: "https://example.com/docs/",
+		ExcludePathRegex: ExcludePathRegex{
+			Pages:  []string{`^/docs/changelog/`, `/internal/`},
+			Assets: []string{`\.mp4$`},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDash: %v", err)
+	}
+
+	tests := []struct {
+		url       string
+		wantPage  bool
+		wantAsset bool
+	}{
+		{url: "https://example.com/docs/changelog/v1.html", wantPage: true},
+		{url: "https://example.com/docs/pkg/internal/a.html", wantPage: true},
+		{url: "https://example.com/docs/intro.mp4", wantAsset: true},
+		{url: "https://example.com/docs/a.html"},
+		// only the path is matched
+		{url: "https://example.com/changelog/docs/changelog/"},
+		{url: "https://example.com/docs/a.html?f=intro.mp4"},
+		{url: "https://example.com/docs/a.html#/internal/"},
+	}
+	for _, tt := range tests {
+		u := mustParseURL(t, tt.url)
+		if got := d.excludedPage(u); got != tt.wantPage {
+			t.Errorf("excludedPage(%s) = %v, want %v", tt.url, got, tt.wantPage)
+		}
+		if got := d.excludedAsset(u); got != tt.wantAsset {
+			t.Errorf("excludedAsset(%s) = %v, want %v", tt.url, got, tt.wantAsset)
+		}
+	}
+
+	if _, err := NewDash(Config{URL: "https://example.com/docs/", ExcludePathRegex: ExcludePathRegex{Assets: []string{"("}}}); err == nil {
+		t.Errorf("NewDash() with an invalid regex err = nil")
+	}
+}
@@ -12,9 +12,11 @@ type docTree struct {
 	path string
 	name string
 
-	documents string
-	plist     string
-	db        string
+	documents  string
+	plist      string
+	db         string
+	manifest   string
+	checkpoint string
 }
 
 func newDocTree(path, name string) *docTree {
@@ -27,13 +29,17 @@ func newDocTree(path, name string) *docTree {
 	documents := filepath.Join(path, docset, "Contents", "Resources", "Documents")
 	plist := filepath.Join(path, docset, "Contents", "Info.plist")
 	db := filepath.Join(path, docset, "Contents", "Resources", "docSet.dsidx")
+	manifest := filepath.Join(path, docset, "Contents", "Resources", "dashdog-manifest.json")
+	checkpoint := filepath.Join(path, docset, "Contents", "Resources", "dashdog-checkpoint.json")
 
 	return &docTree{
-		path:      path,
-		name:      name,
-		documents: documents,
-		plist:     plist,
-		db:        db,
+		path:       path,
+		name:       name,
+		documents:  documents,
+		plist:      plist,
+		db:         db,
+		manifest:   manifest,
+		checkpoint: checkpoint,
 	}
 }
 
@@ -49,6 +55,14 @@ func (t docTree) DB() string {
 	return t.db
 }
 
+func (t docTree) Manifest() string {
+	return t.manifest
+}
+
+func (t docTree) Checkpoint() string {
+	return t.checkpoint
+}
+
 func (t docTree) Mkdir() error {
 	err := os.MkdirAll(t.documents, 0755)
 	if err != nil {
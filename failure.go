@@ -0,0 +1,157 @@
+package dashdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Failure is a page or resource which can not be downloaded or processed in the keep going mode
+type Failure struct {
+	URL      string `json:"url"`
+	Status   int    `json:"status,omitempty"`   // the status code of the response, 0 if there is no response
+	Referrer string `json:"referrer,omitempty"` // the page links to the url, empty for a seed
+	Error    string `json:"error"`
+}
+
+// failures collects the failures of a build in the order they happened, it is safe for concurrent use
+type failures struct {
+	mu   sync.Mutex
+	list []*Failure
+	seen map[string]bool // keyed by the fetch key
+}
+
+func newFailures() *failures {
+	return &failures{
+		seen: map[string]bool{},
+	}
+}
+
+// add records the failure of u, only the first failure of a url is recorded
+func (f *failures) add(u *url.URL, failure *Failure) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := fetchKey(u)
+	if f.seen[key] {
+		return
+	}
+	f.seen[key] = true
+	f.list = append(f.list, failure)
+}
+
+func (f *failures) failed(u *url.URL) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.seen[fetchKey(u)]
+}
+
+// all returns a copy of the failures in order
+func (f *failures) all() []*Failure {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := make([]*Failure, len(f.list))
+	copy(list, f.list)
+	return list
+}
+
+// fail records the failure of u linked from referrer in the keep going mode and returns nil,
+// or returns err as is, the build should abort.
+// referrer is nil for a seed, resp is nil if there is no response.
+func (d *Dash) fail(u, referrer *url.URL, resp *response, err error) error {
+	if !d.config.KeepGoing.Enable {
+		return err
+	}
+
+	failure := &Failure{
+		URL:   u.String(),
+		Error: err.Error(),
+	}
+	if resp != nil {
+		failure.Status = resp.StatusCode()
+	}
+	if referrer != nil {
+		failure.Referrer = referrer.String()
+	}
+	d.failures.add(u, failure)
+	slog.Debug("keep going", slog.String("url", failure.URL), slog.Int("status", failure.Status), slog.String("referrer", failure.Referrer), slog.String("err", fmt.Sprintf("%+v", err)))
+	return nil
+}
+
+// failLink records the failure of link in the keep going mode and leaves the online url in the node, or returns err as is.
+// item is nil if there is no response.
+func (d *Dash) failLink(link *resourceLink, item *fetchItem, referrer *url.URL, err error) error {
+	u := link.u
+	var resp *response
+	if item != nil {
+		// the failure is recorded with the final url, so the redirected links know it failed
+		u, resp = item.u, item.resp
+	}
+	if ferr := d.fail(u, referrer, resp, err); ferr != nil {
+		return ferr
+	}
+	link.node.Attr[link.index].Val = link.u.String()
+	d.state.finish(fetchKey(link.u))
+	return nil
+}
+
+// writeFailureSummary writes the count and a line of every failure to w
+func writeFailureSummary(w io.Writer, list []*Failure) error {
+	if _, err := fmt.Fprintf(w, "%d failures\n", len(list)); err != nil {
+		return errors.Wrap(err, "Fprintf")
+	}
+	for _, failure := range list {
+		line := "    " + failure.URL
+		if failure.Status != 0 {
+			line += fmt.Sprintf(" (status %d)", failure.Status)
+		}
+		if failure.Referrer != "" {
+			line += " linked from " + failure.Referrer
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s\n", line, failure.Error); err != nil {
+			return errors.Wrap(err, "Fprintf")
+		}
+	}
+	return nil
+}
+
+// reportFailures prints the summary of the failures to stderr whatever the log level is and writes them to the report file,
+// it returns ErrTooManyFailures if there are more failures than the max failures
+func (d *Dash) reportFailures() error {
+	if !d.config.KeepGoing.Enable {
+		return nil
+	}
+
+	list := d.failures.all()
+	slog.Debug("keep going", slog.Int("failures", len(list)), slog.Int("max_failures", d.config.KeepGoing.MaxFailures))
+	if len(list) > 0 {
+		if err := writeFailureSummary(os.Stderr, list); err != nil {
+			return errors.Wrapf(err, "writeFailureSummary")
+		}
+	}
+
+	if path := d.config.KeepGoing.Report; path != "" {
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Marshal failures")
+		}
+		path = os.ExpandEnv(path)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return errors.Wrapf(err, "WriteFile %s", path)
+		}
+		slog.Debug("write failure report", slog.String("path", path))
+	}
+
+	if max := d.config.KeepGoing.MaxFailures; max >= 0 && len(list) > max {
+		return errors.Wrapf(ErrTooManyFailures, "%d failures, max %d", len(list), max)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package dashdog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWriteFailureSummary(t *testing.T) {
+	var b bytes.Buffer
+	err := writeFailureSummary(&b, []*Failure{
+		{URL: "https://example.com/a.html", Status: 500, Referrer: "https://example.com/", Error: "status 500"},
+		{URL: "https://example.com/", Error: "timeout"},
+	})
+	if err != nil {
+		t.Fatalf("writeFailureSummary() err = %v", err)
+	}
+	want := `2 failures
+    https://example.com/a.html (status 500) linked from https://example.com/: status 500
+    https://example.com/: timeout
+`
+	if b.String() != want {
+		t.Errorf("writeFailureSummary() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	f := newFailures()
+	f.add(mustParseURL(t, "https://example.com/a.html#Foo"), &Failure{URL: "https://example.com/a.html#Foo", Error: "first"})
+	f.add(mustParseURL(t, "https://example.com/a.html"), &Failure{URL: "https://example.com/a.html", Error: "second"})
+	f.add(mustParseURL(t, "https://example.com/b.html"), &Failure{URL: "https://example.com/b.html", Error: "third"})
+
+	if !f.failed(mustParseURL(t, "https://example.com/a.html#Bar")) {
+		t.Errorf("failed() = false, want true")
+	}
+	if f.failed(mustParseURL(t, "https://example.com/c.html")) {
+		t.Errorf("failed() = true, want false")
+	}
+	// only the first failure of a url is recorded
+	list := f.all()
+	if len(list) != 2 || list[0].Error != "first" || list[1].Error != "third" {
+		t.Errorf("all() = %+v", list)
+	}
+}
+
+// flakySite serves files, the paths in broken fail with 500 until they are fixed
+type flakySite struct {
+	mu     sync.Mutex
+	broken map[string]bool
+	site   http.Handler
+}
+
+func (s *flakySite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	broken := s.broken[r.URL.Path]
+	s.mu.Unlock()
+	if broken {
+		http.Error(w, "broken", http.StatusInternalServerError)
+		return
+	}
+	s.site.ServeHTTP(w, r)
+}
+
+func (s *flakySite) fix() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.broken)
+}
+
+func TestKeepGoing(t *testing.T) {
+	site := &flakySite{
+		broken: map[string]bool{"/docs/a.html": true, "/docs/b.png": true, "/docs/font.woff": true},
+		site: testSiteHandler(map[string]string{
+			"/docs/": `<html><head><link rel="stylesheet" href="app.css"></head><body>
+<a href="a.html">a</a>
+<a href="c.html">c</a>
+<img src="b.png">
+</body></html>`,
+			"/docs/a.html":    "<html><body>a</body></html>",
+			"/docs/c.html":    "<html><body>c</body></html>",
+			"/docs/b.png":     "png",
+			"/docs/app.css":   `@font-face { src: url(font.woff) }`,
+			"/docs/font.woff": "woff",
+		}),
+	}
+	srv := httptest.NewServer(site)
+	defer srv.Close()
+	host := mustParseURL(t, srv.URL).Host
+	report := filepath.Join(t.TempDir(), "failures.json")
+
+	config := Config{
+		URL:         srv.URL + "/docs/",
+		Path:        t.TempDir(),
+		Depth:       2,
+		Incremental: true,
+		KeepGoing:   KeepGoing{Enable: true, MaxFailures: -1, Report: report},
+	}
+	d, err := buildTestDocset(t, config)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	// the failures are recorded with the referrers
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var failures []*Failure
+	if err := json.Unmarshal(data, &failures); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	wantFailures := map[string]string{
+		srv.URL + "/docs/a.html":    srv.URL + "/docs/",
+		srv.URL + "/docs/b.png":     srv.URL + "/docs/",
+		srv.URL + "/docs/font.woff": srv.URL + "/docs/app.css",
+	}
+	if len(failures) != len(wantFailures) {
+		t.Errorf("failures = %s", data)
+	}
+	for _, failure := range failures {
+		if referrer, ok := wantFailures[failure.URL]; !ok || failure.Referrer != referrer || failure.Status != http.StatusInternalServerError {
+			t.Errorf("unexpected failure %+v", failure)
+		}
+	}
+
+	// the failed links point to the online urls
+	page := readDocument(t, d, host+"/docs/index.html")
+	for _, want := range []string{
+		`<a href="` + srv.URL + `/docs/a.html">a</a>`,
+		`<a href="c.html">c</a>`,
+		`<img src="` + srv.URL + `/docs/b.png"/>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the page does not contain %s:\n%s", want, page)
+		}
+	}
+	if css, want := readDocument(t, d, host+"/docs/app.css"), `url(`+srv.URL+`/docs/font.woff)`; !strings.Contains(css, want) {
+		t.Errorf("the stylesheet does not contain %s:\n%s", want, css)
+	}
+
+	// the failed children are marked in the manifest
+	m, err := loadManifest(d.tree.Manifest())
+	if err != nil {
+		t.Fatalf("loadManifest: %v", err)
+	}
+	failed := func(localPath string) map[string]bool {
+		t.Helper()
+		record := m.Files[localPath]
+		if record == nil {
+			t.Fatalf("%s is not in the manifest", localPath)
+		}
+		children := map[string]bool{}
+		for _, child := range record.Children {
+			children[child.URL] = child.Failed
+		}
+		return children
+	}
+	children := failed(host + "/docs/index.html")
+	for u, want := range map[string]bool{
+		srv.URL + "/docs/a.html":  true,
+		srv.URL + "/docs/b.png":   true,
+		srv.URL + "/docs/c.html":  false,
+		srv.URL + "/docs/app.css": false,
+	} {
+		if got, ok := children[u]; !ok || got != want {
+			t.Errorf("the child %s failed = %v, want %v", u, got, want)
+		}
+	}
+	if !failed(host + "/docs/app.css")[srv.URL+"/docs/font.woff"] {
+		t.Errorf("the child font.woff is not failed")
+	}
+
+	// the next incremental build retries the failed children
+	site.fix()
+	d, err = buildTestDocset(t, config)
+	if err != nil {
+		t.Fatalf("Build again: %v", err)
+	}
+	if d.previous == nil {
+		t.Fatalf("the build is not incremental")
+	}
+	if failures := d.failures.all(); len(failures) != 0 {
+		t.Errorf("failures of the incremental build = %+v", failures)
+	}
+	page = readDocument(t, d, host+"/docs/index.html")
+	for _, want := range []string{`<a href="a.html">a</a>`, `<img src="b.png"/>`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the page does not contain %s:\n%s", want, page)
+		}
+	}
+	if css := readDocument(t, d, host+"/docs/app.css"); !strings.Contains(css, "url(font.woff)") {
+		t.Errorf("the stylesheet does not link the local font:\n%s", css)
+	}
+	for _, p := range []string{"/docs/a.html", "/docs/b.png", "/docs/font.woff"} {
+		if !documentExists(d, host+p) {
+			t.Errorf("%s is not downloaded", p)
+		}
+	}
+	m, err = loadManifest(d.tree.Manifest())
+	if err != nil {
+		t.Fatalf("loadManifest: %v", err)
+	}
+	for _, record := range m.Files {
+		for _, child := range record.Children {
+			if child.Failed {
+				t.Errorf("the child %s of %s is still failed", child.URL, record.URL)
+			}
+		}
+	}
+}
+
+func TestKeepGoingMaxFailures(t *testing.T) {
+	srv := newTestSite(t, map[string]string{
+		"/docs/":       `<html><body><a href="a.html">a</a><a href="b.html">b</a><a href="c.html">c</a></body></html>`,
+		"/docs/c.html": "<html><body>c</body></html>",
+	})
+	host := mustParseURL(t, srv.URL).Host
+
+	tests := []struct {
+		name        string
+		maxFailures int
+		wantErr     error
+	}{
+		{name: "under", maxFailures: 2},
+		{name: "never", maxFailures: -1},
+		{name: "over", maxFailures: 1, wantErr: ErrTooManyFailures},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the missing pages are failures
+			d, err := buildTestDocset(t, Config{URL: srv.URL + "/docs/", Depth: 2, KeepGoing: KeepGoing{Enable: true, MaxFailures: tt.maxFailures}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Build() err = %v, want %v", err, tt.wantErr)
+			}
+			// the docset is written anyway
+			if !documentExists(d, host+"/docs/c.html") {
+				t.Errorf("the docset is not written")
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package dashdog
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+// response is the result of a fetch, it may come from the network or the cache
+type response struct {
+	statusCode int
+	status     string
+	header     http.Header
+	body       []byte
+	location   *url.URL // the final url after the redirects, nil if it is unknown
+}
+
+func newResponse(resp *resty.Response) *response {
+	r := &response{
+		statusCode: resp.StatusCode(),
+		status:     resp.Status(),
+		header:     resp.Header(),
+		body:       resp.Body(),
+	}
+	if resp.RawResponse != nil && resp.RawResponse.Request != nil {
+		r.location = resp.RawResponse.Request.URL
+	}
+	return r
+}
+
+func (r response) StatusCode() int {
+	return r.statusCode
+}
+
+func (r response) Status() string {
+	return r.status
+}
+
+func (r response) Header() http.Header {
+	return r.header
+}
+
+func (r response) Body() []byte {
+	return r.body
+}
+
+// fetchTask is a url queued to the fetcher, the result is ready after done is closed
+type fetchTask struct {
+	u      *url.URL
+	resp   *response
+	err    error
+	record *fileRecord // the file finished before the checkpoint, it is not fetched again
+	done   chan struct{}
+}
+
+func (t *fetchTask) wait() (*response, error) {
+	<-t.done
+	return t.resp, t.err
+}
+
+// fetcher downloads the queued urls with a bounded pool of workers.
+// Every url is downloaded only once, submit the same url again returns the same task.
+type fetcher struct {
+	httpClient  *resty.Client
+	cache       *httpCache
+	concurrency int
+	ctx         context.Context // the requests are canceled if it is done
+	sourceDir   string          // the dir to read the local files, the local files are never read if it is empty
+	metaRefresh bool            // follow the `<meta http-equiv=refresh>` pages like the http redirects
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*fetchTask
+	tasks  map[string]*fetchTask
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+func newFetcher(httpClient *resty.Client, cache *httpCache, concurrency int) *fetcher {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	f := &fetcher{
+		httpClient:  httpClient,
+		cache:       cache,
+		concurrency: concurrency,
+		ctx:         context.Background(),
+		tasks:       map[string]*fetchTask{},
+	}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *fetcher) start(ctx context.Context) {
+	f.ctx = ctx
+	for i := 0; i < f.concurrency; i++ {
+		f.wg.Add(1)
+		go f.work()
+	}
+	slog.Debug("fetcher start", slog.Int("concurrency", f.concurrency))
+}
+
+// stop waits the running requests to finish, the tasks still in queue will never be done
+func (f *fetcher) stop() {
+	f.mu.Lock()
+	f.closed = true
+	f.cond.Broadcast()
+	f.mu.Unlock()
+	f.wg.Wait()
+	slog.Debug("fetcher stop")
+}
+
+// submit queues u to download and returns immediately
+func (f *fetcher) submit(u *url.URL) *fetchTask {
+	key := fetchKey(u)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if task, ok := f.tasks[key]; ok {
+		return task
+	}
+
+	task := &fetchTask{
+		u:    u,
+		done: make(chan struct{}),
+	}
+	f.tasks[key] = task
+	f.queue = append(f.queue, task)
+	f.cond.Signal()
+	return task
+}
+
+// alias shares task with the final url of a redirected task, so the final url is never downloaded again
+func (f *fetcher) alias(task *fetchTask) {
+	loc := task.resp.location
+	if loc == nil {
+		return
+	}
+	key := fetchKey(loc)
+	if key == fetchKey(task.u) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.tasks[key]; !ok {
+		f.tasks[key] = task
+	}
+}
+
+func (f *fetcher) pop() (*fetchTask, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.queue) == 0 && !f.closed {
+		f.cond.Wait()
+	}
+	if f.closed {
+		return nil, false
+	}
+
+	task := f.queue[0]
+	f.queue[0] = nil
+	f.queue = f.queue[1:]
+	return task, true
+}
+
+func (f *fetcher) work() {
+	defer f.wg.Done()
+	for {
+		task, ok := f.pop()
+		if !ok {
+			return
+		}
+		task.resp, task.err = f.get(task.u)
+		if task.err == nil && f.metaRefresh {
+			task.resp, task.err = f.followMetaRefresh(task.u, task.resp)
+		}
+		if task.err == nil {
+			f.alias(task)
+		}
+		slog.Debug("fetch", slog.String("url", task.u.String()), slog.Any("err", task.err))
+		close(task.done)
+	}
+}
+
+// get downloads u, the cached response will be revalidated and reused if the server says it is not modified
+func (f *fetcher) get(u *url.URL) (*response, error) {
+	if isLocal(u) {
+		return f.readFile(u)
+	}
+
+	if f.cache == nil {
+		resp, err := f.httpClient.R().SetContext(f.ctx).Get(u.String())
+		if err != nil {
+			return nil, errors.Wrapf(err, "Get %s", u.String())
+		}
+		return newResponse(resp), nil
+	}
+
+	key := fetchKey(u)
+	entry, err := f.cache.load(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load cache of %s", key)
+	}
+
+	if f.cache.offline {
+		if entry == nil {
+			return nil, errors.Wrapf(ErrNotCached, "%s", key)
+		}
+		slog.Debug("cache hit offline", slog.String("url", key))
+		return entry.response(), nil
+	}
+
+	req := f.httpClient.R().SetContext(f.ctx)
+	if entry != nil {
+		if entry.ETag != "" {
+			req.SetHeader("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.SetHeader("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := req.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Get %s", u.String())
+	}
+
+	if resp.StatusCode() == http.StatusNotModified && entry != nil {
+		slog.Debug("cache not modified", slog.String("url", key))
+		return entry.response(), nil
+	}
+
+	r := newResponse(resp)
+	if cacheable(r.StatusCode()) {
+		if err := f.cache.store(key, r); err != nil {
+			return nil, errors.Wrapf(err, "store cache of %s", key)
+		}
+		slog.Debug("cache store", slog.String("url", key))
+	}
+	return r, nil
+}
+
+// fetchKey is the key of u to download, the fragment is never sent to the server
+func fetchKey(u *url.URL) string {
+	cu := *u
+	cu.Fragment = ""
+	cu.RawFragment = ""
+	return cu.String()
+}
@@ -0,0 +1,140 @@
+package dashdog
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// docsetFiles returns the content of every file in the Documents dir of d, keyed by the slash separated path
+func docsetFiles(t *testing.T, d *Dash) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(d.tree.Documents(), func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(d.tree.Documents(), p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+	return files
+}
+
+// indexRows returns the rows of the search index of d in the order of insertion
+func indexRows(t *testing.T, d *Dash) []string {
+	t.Helper()
+	db, err := sql.Open("sqlite3", d.tree.DB())
+	if err != nil {
+		t.Fatalf("Open db: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name, type, path FROM searchIndex ORDER BY id`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+
+	list := make([]string, 0)
+	for rows.Next() {
+		var name, etype, path string
+		if err := rows.Scan(&name, &etype, &path); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		list = append(list, strings.Join([]string{name, etype, path}, " "))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows: %v", err)
+	}
+	return list
+}
+
+func TestConcurrencyDeterministic(t *testing.T) {
+	// a tree of pages, every page links to its children, its parent, the shared resources and its own resources
+	files := map[string]string{
+		"/static/app.css":    `body { background: url(img/bg.png) }`,
+		"/static/img/bg.png": "bg",
+		"/static/app.js":     "js",
+	}
+	pages := 0
+	var page func(p string, depth int)
+	page = func(p string, depth int) {
+		pages++
+		var b strings.Builder
+		b.WriteString(`<html><head><link rel="stylesheet" href="/static/app.css"><script src="/static/app.js"></script></head><body>`)
+		fmt.Fprintf(&b, `<h2>%s</h2><a href="/docs/">home</a>`, strings.Trim(p, "/"))
+		fmt.Fprintf(&b, `<img src="%s.png">`, p)
+		files[p+".png"] = p
+		if depth > 0 {
+			for i := 0; i < 4; i++ {
+				child := fmt.Sprintf("%s/%d", strings.TrimSuffix(p, "/"), i)
+				fmt.Fprintf(&b, `<a href="%s">%d</a>`, child, i)
+				page(child, depth-1)
+			}
+		}
+		b.WriteString(`</body></html>`)
+		files[p] = b.String()
+	}
+	page("/docs/", 3)
+	srv := newTestSite(t, files)
+
+	build := func(concurrency int) (map[string]string, []string) {
+		t.Helper()
+		d, err := buildTestDocset(t, Config{
+			URL:         srv.URL + "/docs/",
+			Depth:       4,
+			Concurrency: concurrency,
+			Index: Index{IndexRows: []IndexRow{
+				{Selector: "h2", Type: "Guide", Name: IndexName{Type: IndexNameTypeText}},
+			}},
+		})
+		if err != nil {
+			t.Fatalf("Build with concurrency %d: %v", concurrency, err)
+		}
+		return docsetFiles(t, d), indexRows(t, d)
+	}
+
+	wantFiles, wantRows := build(1)
+	// a package row and a guide row of every page
+	if len(wantRows) != 2*pages {
+		t.Fatalf("%d index rows, want %d", len(wantRows), 2*pages)
+	}
+	for _, concurrency := range []int{2, 8, 32} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			gotFiles, gotRows := build(concurrency)
+
+			if len(gotFiles) != len(wantFiles) {
+				t.Errorf("%d files, want %d", len(gotFiles), len(wantFiles))
+			}
+			for p, want := range wantFiles {
+				got, ok := gotFiles[p]
+				if !ok {
+					t.Errorf("%s is missing", p)
+					continue
+				}
+				if got != want {
+					t.Errorf("%s =\n%s\nwant\n%s", p, got, want)
+				}
+			}
+
+			if strings.Join(gotRows, "\n") != strings.Join(wantRows, "\n") {
+				t.Errorf("index rows =\n%s\nwant\n%s", strings.Join(gotRows, "\n"), strings.Join(wantRows, "\n"))
+			}
+		})
+	}
+}
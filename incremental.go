@@ -0,0 +1,258 @@
+package dashdog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// manifest records the files of a docset, the next incremental build compares against it
+type manifest struct {
+	ConfigHash string                 `json:"config_hash"`
+	Files      map[string]*fileRecord `json:"files"` // keyed by the local path
+}
+
+// fileRecord is a file written to the Documents dir
+type fileRecord struct {
+	URL         string      `json:"url"`
+	ContentType string      `json:"content_type"`
+	Hash        string      `json:"hash"` // hash of the source body
+	Level       int         `json:"level"`
+	Page        bool        `json:"page"`
+	Children    []childLink `json:"children,omitempty"` // the pages and resources the page links to
+	Refs        []refRecord `json:"refs,omitempty"`     // the references of the page
+	Alias       string      `json:"alias,omitempty"`    // the final url if the file is a redirect stub
+}
+
+// childLink is a page or resource fetched from a page
+type childLink struct {
+	URL       string `json:"url"`
+	LocalPath string `json:"local_path"`
+	Level     int    `json:"level"`
+	Page      bool   `json:"page"`
+	Alias     string `json:"alias,omitempty"`  // the url linked from the page if it is redirected to URL
+	Failed    bool   `json:"failed,omitempty"` // the child failed in the keep going mode, the page links to the online url
+}
+
+type refRecord struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Bundle    string `json:"bundle"`
+	LocalPath string `json:"local_path"`
+	Anchor    string `json:"anchor"`
+}
+
+func newRefRecord(ref *Reference) refRecord {
+	return refRecord{
+		Name:      ref.name,
+		Type:      ref.etype,
+		Bundle:    ref.bundle,
+		LocalPath: ref.localPath,
+		Anchor:    ref.anchor,
+	}
+}
+
+func (r refRecord) reference() *Reference {
+	return &Reference{
+		name:      r.Name,
+		etype:     r.Type,
+		bundle:    r.Bundle,
+		localPath: r.LocalPath,
+		anchor:    r.Anchor,
+	}
+}
+
+// loadManifest returns nil if the manifest does not exist
+func loadManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadFile %s", path)
+	}
+
+	m := &manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s", path)
+	}
+	return m, nil
+}
+
+func saveManifest(path string, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "Marshal manifest")
+	}
+	return errors.Wrapf(writeFileAtomic(path, data), "writeFileAtomic %s", path)
+}
+
+// configHash is the hash of the config items which change the generated files,
+// the previous files can not be reused if it changes
+func configHash(config Config) string {
+	config.Path = ""
+	config.Concurrency = 0
+	config.Cache = Cache{}
+	config.Incremental = false
+	config.Resume = false
+	config.Retry = Retry{}
+	config.RateLimit = RateLimit{}
+	config.UserAgent = ""
+	config.HTTP = HTTP{}
+	config.SourceDir = ""
+	config.Check = false
+	config.KeepGoing = KeepGoing{}
+
+	data, _ := json.Marshal(config)
+	return contentHash(data)
+}
+
+func contentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// unchanged returns the previous record of item if the source body is the same as the previous build
+// and the file is still there, or returns nil
+func (d Dash) unchanged(item *fetchItem, hash string) *fileRecord {
+	if d.previous == nil {
+		return nil
+	}
+
+	record := d.previous.Files[item.localPath()]
+	if record == nil || record.Hash != hash {
+		return nil
+	}
+	// a shared resource is the same file whoever links it
+	if item.assetHash == "" && (record.Level != item.level || record.Page != item.needPopulate) {
+		return nil
+	}
+
+	absPath := filepath.Join(d.tree.Documents(), item.localPath())
+	if _, err := os.Stat(absPath); err != nil {
+		return nil
+	}
+	return record
+}
+
+// revisit visits the children of an unchanged page without transforming the page again.
+// It returns false if a child is not the same as the previous build, the page should be transformed again.
+func (d *Dash) revisit(record *fileRecord) (bool, error) {
+	tasks := make([]*fetchTask, 0, len(record.Children))
+	urls := make([]*url.URL, 0, len(record.Children))
+	for _, child := range record.Children {
+		if child.Failed {
+			// try the failed child again
+			return false, nil
+		}
+		// request the alias again, so the redirect stub is written again
+		rawURL := child.URL
+		if child.Alias != "" {
+			rawURL = child.Alias
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return false, errors.Wrapf(err, "Parse %s", rawURL)
+		}
+		urls = append(urls, u)
+		tasks = append(tasks, d.submit(u))
+	}
+
+	for i, child := range record.Children {
+		item, err := d.newFetchItem(urls[i], child.Level, child.Page, tasks[i])
+		if err != nil {
+			if d.config.KeepGoing.Enable {
+				// the page is transformed again and the failure is recorded there
+				return false, nil
+			}
+			return false, errors.Wrapf(err, "newFetchItem")
+		}
+		if item.resp.StatusCode() != http.StatusOK || item.needPopulate != child.Page || item.localPath() != child.LocalPath {
+			slog.Debug("child changed", slog.String("url", child.URL), slog.Int("status", item.resp.StatusCode()))
+			return false, nil
+		}
+
+		if _, err := d.populateData(item); err != nil {
+			// the referrer is written by ourselves, it never fails to parse
+			referrer, _ := url.Parse(record.URL)
+			if ferr := d.fail(item.u, referrer, item.resp, err); ferr != nil {
+				return false, errors.Wrapf(ferr, "populateData")
+			}
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// prune removes the files of the previous build which are not generated by this build
+func (d Dash) prune() error {
+	if d.previous == nil {
+		return nil
+	}
+
+	for localPath := range d.previous.Files {
+		if d.state.hasFile(localPath) {
+			continue
+		}
+
+		absPath := filepath.Join(d.tree.Documents(), localPath)
+		if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Remove %s", absPath)
+		}
+		slog.Debug("remove stale file", slog.String("path", absPath))
+
+		// remove the empty parent dirs
+		for dir := filepath.Dir(absPath); dir != d.tree.Documents(); dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// syncDB deletes the rows which are not referenced any more and inserts the new rows
+func (d *Dash) syncDB() error {
+	refs := d.state.references()
+	want := make(map[[3]string]bool, len(refs))
+	for _, ref := range refs {
+		want[[3]string{ref.name, ref.etype, ref.href()}] = true
+	}
+
+	rows, err := d.db.Query(`SELECT id, name, type, path FROM searchIndex`)
+	if err != nil {
+		return errors.Wrap(err, "select searchIndex")
+	}
+	stale := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		var name, etype, path string
+		if err := rows.Scan(&id, &name, &etype, &path); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "scan searchIndex")
+		}
+		if !want[[3]string{name, etype, path}] {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "iterate searchIndex")
+	}
+
+	for _, id := range stale {
+		if _, err := d.db.Exec(`DELETE FROM searchIndex WHERE id = ?`, id); err != nil {
+			return errors.Wrapf(err, "delete searchIndex %d", id)
+		}
+	}
+	slog.Debug("delete stale rows", slog.Int("count", len(stale)))
+
+	return d.insertDB()
+}
@@ -0,0 +1,296 @@
+package dashdog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDash returns a Dash building into a temporary dir with the fetcher started
+func newTestDash(t *testing.T, rawURL string) *Dash {
+	t.Helper()
+	d, err := NewDash(Config{
+		Path:         t.TempDir(),
+		Name:         "test",
+		URL:          rawURL,
+		IgnoreRobots: true,
+	})
+	if err != nil {
+		t.Fatalf("NewDash: %v", err)
+	}
+	d.fetcher.start(context.Background())
+	t.Cleanup(d.fetcher.stop)
+	return d
+}
+
+// writeDocument writes a file to the Documents dir of d
+func writeDocument(t *testing.T, d *Dash, localPath, content string) {
+	t.Helper()
+	if err := d.saveFile(localPath, []byte(content)); err != nil {
+		t.Fatalf("saveFile %s: %v", localPath, err)
+	}
+}
+
+func documentExists(d *Dash, localPath string) bool {
+	_, err := os.Stat(filepath.Join(d.tree.Documents(), localPath))
+	return err == nil
+}
+
+func TestConfigHash(t *testing.T) {
+	base := Config{URL: "https://example.com/docs/", Depth: 2}
+	hash := configHash(base)
+
+	runtime := map[string]func(c *Config){
+		"path":        func(c *Config) { c.Path = "/tmp/out" },
+		"concurrency": func(c *Config) { c.Concurrency = 8 },
+		"cache":       func(c *Config) { c.Cache = Cache{Dir: "/tmp/cache", Offline: true} },
+		"incremental": func(c *Config) { c.Incremental = true },
+		"resume":      func(c *Config) { c.Resume = true },
+		"retry":       func(c *Config) { c.Retry.MaxAttempts = 3 },
+		"rate limit":  func(c *Config) { c.RateLimit.RequestsPerSecond = 2 },
+		"user agent":  func(c *Config) { c.UserAgent = "bot" },
+		"http":        func(c *Config) { c.HTTP.BearerToken = "token" },
+		"source dir":  func(c *Config) { c.SourceDir = "/tmp/site" },
+		"check":       func(c *Config) { c.Check = true },
+		"keep going":  func(c *Config) { c.KeepGoing = KeepGoing{Enable: true, MaxFailures: 3, Report: "/tmp/failures.json"} },
+	}
+	for name, set := range runtime {
+		t.Run(name, func(t *testing.T) {
+			config := base
+			set(&config)
+			if got := configHash(config); got != hash {
+				t.Errorf("configHash changed by the runtime option %s", name)
+			}
+		})
+	}
+
+	output := map[string]func(c *Config){
+		"url":           func(c *Config) { c.URL = "https://example.com/api/" },
+		"depth":         func(c *Config) { c.Depth = 3 },
+		"page":          func(c *Config) { c.Page.RemoveNodeSelector = []string{"nav"} },
+		"query":         func(c *Config) { c.Query.Policy = QueryPolicyHash },
+		"shared assets": func(c *Config) { c.SharedAssets = true },
+	}
+	for name, set := range output {
+		t.Run(name, func(t *testing.T) {
+			config := base
+			set(&config)
+			if got := configHash(config); got == hash {
+				t.Errorf("configHash not changed by the output option %s", name)
+			}
+		})
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	const localPath = "example.com/docs/a.html"
+	const hash = "1a2b3c4d5e6f7a8b9c0d"
+
+	tests := []struct {
+		name     string
+		previous *manifest
+		noFile   bool
+		item     fetchItem
+		hash     string
+		want     bool
+	}{
+		{
+			name:     "not incremental",
+			previous: nil,
+			item:     fetchItem{level: 1, needPopulate: true},
+			hash:     hash,
+			want:     false,
+		},
+		{
+			name:     "same",
+			previous: &manifest{Files: map[string]*fileRecord{localPath: {Hash: hash, Level: 1, Page: true}}},
+			item:     fetchItem{level: 1, needPopulate: true},
+			hash:     hash,
+			want:     true,
+		},
+		{
+			name:     "new file",
+			previous: &manifest{Files: map[string]*fileRecord{}},
+			item:     fetchItem{level: 1, needPopulate: true},
+			hash:     hash,
+			want:     false,
+		},
+		{
+			name:     "content changed",
+			previous: &manifest{Files: map[string]*fileRecord{localPath: {Hash: hash, Level: 1, Page: true}}},
+			item:     fetchItem{level: 1, needPopulate: true},
+			hash:     "ffff",
+			want:     false,
+		},
+		{
+			name:     "level changed",
+			previous: &manifest{Files: map[string]*fileRecord{localPath: {Hash: hash, Level: 1, Page: true}}},
+			item:     fetchItem{level: 2, needPopulate: true},
+			hash:     hash,
+			want:     false,
+		},
+		{
+			name:     "page changed to a resource",
+			previous: &manifest{Files: map[string]*fileRecord{localPath: {Hash: hash, Level: 1, Page: true}}},
+			item:     fetchItem{level: 1, needPopulate: false},
+			hash:     hash,
+			want:     false,
+		},
+		{
+			name:     "file removed",
+			previous: &manifest{Files: map[string]*fileRecord{localPath: {Hash: hash, Level: 1, Page: true}}},
+			noFile:   true,
+			item:     fetchItem{level: 1, needPopulate: true},
+			hash:     hash,
+			want:     false,
+		},
+		{
+			name:     "shared asset linked from another level",
+			previous: &manifest{Files: map[string]*fileRecord{"_assets/1a2b3c4d5e6f7a8b.html": {Hash: hash, Level: 1}}},
+			item:     fetchItem{level: 3, assetHash: "1a2b3c4d5e6f7a8b"},
+			hash:     hash,
+			want:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dash{
+				tree:     newDocTree(t.TempDir(), "test"),
+				previous: tt.previous,
+			}
+			item := tt.item
+			item.u = mustParseURL(t, "https://example.com/docs/a")
+			item.suffix = ".html"
+			if !tt.noFile {
+				writeDocument(t, d, item.localPath(), "<html></html>")
+			}
+
+			got := d.unchanged(&item, tt.hash)
+			if (got != nil) != tt.want {
+				t.Errorf("unchanged() = %+v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevisit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/style.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("png"))
+		case "/sub":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html><body>sub</body></html>"))
+		case "/old":
+			http.Redirect(w, r, "/sub", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	host := mustParseURL(t, srv.URL).Host
+	png := childLink{URL: srv.URL + "/style.png", LocalPath: host + "/style.png"}
+	sub := childLink{URL: srv.URL + "/sub", LocalPath: host + "/sub.html", Level: 1, Page: true}
+
+	tests := []struct {
+		name      string
+		children  []childLink
+		want      bool
+		wantFiles []string
+	}{
+		{name: "no children", children: nil, want: true},
+		{name: "same children", children: []childLink{png, sub}, want: true, wantFiles: []string{png.LocalPath, sub.LocalPath}},
+		{name: "redirected child", children: []childLink{{URL: srv.URL + "/sub", Alias: srv.URL + "/old", LocalPath: host + "/sub.html", Level: 1, Page: true}}, want: true, wantFiles: []string{sub.LocalPath}},
+		{name: "failed child", children: []childLink{{URL: srv.URL + "/style.png", Failed: true}}, want: false},
+		{name: "missing child", children: []childLink{{URL: srv.URL + "/gone.png", LocalPath: host + "/gone.png"}}, want: false},
+		{name: "local path changed", children: []childLink{{URL: srv.URL + "/style.png", LocalPath: host + "/style-1a2b3c4d.png"}}, want: false},
+		{name: "page changed to a resource", children: []childLink{{URL: srv.URL + "/style.png", LocalPath: host + "/style.png", Page: true}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDash(t, srv.URL+"/")
+			record := &fileRecord{URL: srv.URL + "/", Page: true, Children: tt.children}
+
+			got, err := d.revisit(record)
+			if err != nil {
+				t.Fatalf("revisit() err = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("revisit() = %v, want %v", got, tt.want)
+			}
+			for _, localPath := range tt.wantFiles {
+				if !d.state.hasFile(localPath) {
+					t.Errorf("%s is not recorded", localPath)
+				}
+				if !documentExists(d, localPath) {
+					t.Errorf("%s is not written", localPath)
+				}
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	d := &Dash{
+		tree:  newDocTree(t.TempDir(), "test"),
+		state: newCrawlState(),
+	}
+
+	kept := []string{"example.com/docs/a.html", "example.com/static/app.css"}
+	stale := []string{"example.com/docs/b.html", "example.com/old/deep/c.html", "example.com/static/old.css"}
+	d.previous = &manifest{Files: map[string]*fileRecord{}}
+	for _, localPath := range append(append([]string{}, kept...), stale...) {
+		writeDocument(t, d, localPath, "x")
+		d.previous.Files[localPath] = &fileRecord{}
+	}
+	for _, localPath := range kept {
+		d.state.addFile(localPath, &fileRecord{})
+	}
+	// a stale file removed by hand does not fail the prune
+	d.previous.Files["example.com/docs/removed.html"] = &fileRecord{}
+
+	if err := d.prune(); err != nil {
+		t.Fatalf("prune() err = %v", err)
+	}
+	for _, localPath := range kept {
+		if !documentExists(d, localPath) {
+			t.Errorf("%s is removed", localPath)
+		}
+	}
+	for _, localPath := range stale {
+		if documentExists(d, localPath) {
+			t.Errorf("%s is not removed", localPath)
+		}
+	}
+	if documentExists(d, "example.com/old") {
+		t.Errorf("the empty dirs are not removed")
+	}
+	if !documentExists(d, "example.com/static") {
+		t.Errorf("the dir of a kept file is removed")
+	}
+	if _, err := os.Stat(d.tree.Documents()); err != nil {
+		t.Errorf("the Documents dir is removed: %v", err)
+	}
+}
+
+func TestPruneNotIncremental(t *testing.T) {
+	d := &Dash{
+		tree:  newDocTree(t.TempDir(), "test"),
+		state: newCrawlState(),
+	}
+	writeDocument(t, d, "example.com/docs/a.html", "x")
+
+	if err := d.prune(); err != nil {
+		t.Fatalf("prune() err = %v", err)
+	}
+	if !documentExists(d, "example.com/docs/a.html") {
+		t.Errorf("a file is removed without the previous build")
+	}
+}
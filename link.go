@@ -0,0 +1,85 @@
+package dashdog
+
+import (
+	"net/url"
+	"strings"
+
+	css "github.com/andybalholm/cascadia"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// documentBase returns the base url to resolve the links of doc, it is the href of the first `<base>` or the page url.
+// The `<base>` nodes are removed, because the links are rewritten to the relative paths of the local files.
+func documentBase(pageURL *url.URL, doc *html.Node) (*url.URL, error) {
+	base := pageURL
+
+	nodes := css.MustCompile("base[href]").MatchAll(doc)
+	for i, node := range nodes {
+		if i == 0 {
+			ref, err := url.Parse(strings.TrimSpace(attr(node, "href")))
+			if err != nil {
+				return nil, errors.Wrapf(err, "Parse base %s", attr(node, "href"))
+			}
+			base = pageURL.ResolveReference(ref)
+		}
+		node.Parent.RemoveChild(node)
+	}
+	return base, nil
+}
+
+// resolveLink resolves the href/src value against base as RFC 3986,
+// ok is false if the link can not be downloaded, e.g. mailto:, javascript: and data:
+func resolveLink(base *url.URL, val string) (u *url.URL, ok bool, err error) {
+	ref, err := url.Parse(strings.TrimSpace(val))
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "Parse %s", val)
+	}
+
+	u = base.ResolveReference(ref)
+	// the fragment is always the one of the reference, ResolveReference keeps the fragment of base for an empty reference
+	u.Fragment = ref.Fragment
+	u.RawFragment = ref.RawFragment
+	return u, downloadable(u), nil
+}
+
+// downloadable reports whether the scheme of u can be downloaded
+func downloadable(u *url.URL) bool {
+	switch u.Scheme {
+	case "http", "https", "file":
+		return true
+	default:
+		return false
+	}
+}
+
+// relativePath returns the relative path of the local file to from the dir of the local file from
+func relativePath(from, to string) string {
+	fromDirs := strings.Split(from, "/")
+	fromDirs = fromDirs[:len(fromDirs)-1]
+	toParts := strings.Split(to, "/")
+
+	common := 0
+	for common < len(fromDirs) && common < len(toParts)-1 && fromDirs[common] == toParts[common] {
+		common++
+	}
+
+	parts := make([]string, 0, len(fromDirs)-common+len(toParts)-common)
+	for i := common; i < len(fromDirs); i++ {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, toParts[common:]...)
+	return strings.Join(parts, "/")
+}
+
+// relativeLink returns the link in the local file from to the local file to,
+// the query and the fragment of u are kept
+func relativeLink(from, to string, u *url.URL) string {
+	ru := &url.URL{
+		Path:        relativePath(from, to),
+		RawQuery:    u.RawQuery,
+		Fragment:    u.Fragment,
+		RawFragment: u.RawFragment,
+	}
+	return ru.String()
+}
@@ -0,0 +1,163 @@
+package dashdog
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatalf("Parse %s: %v", s, err)
+	}
+	return u
+}
+
+func TestResolveLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		val     string
+		want    string
+		wantOK  bool
+		wantErr bool
+	}{
+		{name: "parent dir", base: "https://example.com/docs/pkg/index.html", val: "../static/app.css", want: "https://example.com/docs/static/app.css", wantOK: true},
+		{name: "current dir", base: "https://example.com/docs/pkg/index.html", val: "./img.png", want: "https://example.com/docs/pkg/img.png", wantOK: true},
+		{name: "bare file", base: "https://example.com/docs/pkg/index.html", val: "img.png", want: "https://example.com/docs/pkg/img.png", wantOK: true},
+		{name: "base without trailing slash", base: "https://example.com/docs/pkg", val: "sub", want: "https://example.com/docs/sub", wantOK: true},
+		{name: "base with trailing slash", base: "https://example.com/docs/pkg/", val: "sub", want: "https://example.com/docs/pkg/sub", wantOK: true},
+		{name: "absolute path", base: "https://example.com/docs/pkg/index.html", val: "/abs/x.js", want: "https://example.com/abs/x.js", wantOK: true},
+		{name: "scheme relative", base: "https://example.com/docs/", val: "//cdn.example.com/x.js", want: "https://cdn.example.com/x.js", wantOK: true},
+		{name: "absolute url", base: "https://example.com/docs/", val: "http://other.example.com/a", want: "http://other.example.com/a", wantOK: true},
+		{name: "fragment only", base: "https://example.com/docs/pkg/index.html", val: "#Foo", want: "https://example.com/docs/pkg/index.html#Foo", wantOK: true},
+		{name: "query only", base: "https://example.com/docs/pkg/index.html?a=1", val: "?b=2", want: "https://example.com/docs/pkg/index.html?b=2", wantOK: true},
+		{name: "empty", base: "https://example.com/docs/pkg/index.html#Foo", val: "", want: "https://example.com/docs/pkg/index.html", wantOK: true},
+		{name: "above the root", base: "https://example.com/docs/pkg/index.html", val: "../../../../x.css", want: "https://example.com/x.css", wantOK: true},
+		{name: "dot segments", base: "https://example.com/docs/pkg/", val: "a/./b/../c.html", want: "https://example.com/docs/pkg/a/c.html", wantOK: true},
+		{name: "spaces around", base: "https://example.com/docs/", val: "  a.html\n", want: "https://example.com/docs/a.html", wantOK: true},
+		{name: "local file", base: "file://localhost/guide/index.html", val: "../static/a.css", want: "file://localhost/static/a.css", wantOK: true},
+		{name: "mailto", base: "https://example.com/docs/", val: "mailto:a@example.com", want: "mailto:a@example.com", wantOK: false},
+		{name: "javascript", base: "https://example.com/docs/", val: "javascript:void(0)", want: "javascript:void(0)", wantOK: false},
+		{name: "data", base: "https://example.com/docs/", val: "data:image/png;base64,AAAA", want: "data:image/png;base64,AAAA", wantOK: false},
+		{name: "invalid", base: "https://example.com/docs/", val: "http://[::1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, ok, err := resolveLink(mustParseURL(t, tt.base), tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveLink() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if ok != tt.wantOK {
+				t.Errorf("resolveLink() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if u.String() != tt.want {
+				t.Errorf("resolveLink() = %s, want %s", u.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentBase(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		html    string
+		want    string
+		wantErr bool
+	}{
+		{name: "no base", page: "https://example.com/docs/pkg/index.html", html: `<html><head></head><body></body></html>`, want: "https://example.com/docs/pkg/index.html"},
+		{name: "relative base", page: "https://example.com/docs/pkg/index.html", html: `<html><head><base href="../"></head><body></body></html>`, want: "https://example.com/docs/"},
+		{name: "absolute path base", page: "https://example.com/docs/pkg/index.html", html: `<html><head><base href="/static/"></head><body></body></html>`, want: "https://example.com/static/"},
+		{name: "absolute url base", page: "https://example.com/docs/pkg/index.html", html: `<html><head><base href="https://cdn.example.com/v2/"></head><body></body></html>`, want: "https://cdn.example.com/v2/"},
+		{name: "the first base wins", page: "https://example.com/docs/", html: `<html><head><base href="/a/"><base href="/b/"></head><body></body></html>`, want: "https://example.com/a/"},
+		{name: "base without href", page: "https://example.com/docs/", html: `<html><head><base target="_blank"></head><body></body></html>`, want: "https://example.com/docs/"},
+		{name: "invalid base", page: "https://example.com/docs/", html: `<html><head><base href="http://[::1"></head><body></body></html>`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("html.Parse: %v", err)
+			}
+
+			base, err := documentBase(mustParseURL(t, tt.page), doc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("documentBase() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if base.String() != tt.want {
+				t.Errorf("documentBase() = %s, want %s", base.String(), tt.want)
+			}
+
+			var b bytes.Buffer
+			if err := html.Render(&b, doc); err != nil {
+				t.Fatalf("html.Render: %v", err)
+			}
+			if strings.Contains(b.String(), "href=") {
+				t.Errorf("the base href is not removed: %s", b.String())
+			}
+		})
+	}
+}
+
+func TestRelativeLink(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		u    string
+		want string
+	}{
+		{name: "same dir", from: "example.com/docs/a.html", to: "example.com/docs/b.html", u: "https://example.com/docs/b", want: "b.html"},
+		{name: "sub dir", from: "example.com/docs.html", to: "example.com/docs/pkg/a.html", u: "https://example.com/docs/pkg/a", want: "docs/pkg/a.html"},
+		{name: "parent dir", from: "example.com/docs/pkg/a.html", to: "example.com/static/a.css", u: "https://example.com/static/a.css", want: "../../static/a.css"},
+		{name: "sibling dir", from: "example.com/guide/a.html", to: "example.com/api/b.html", u: "https://example.com/api/b", want: "../api/b.html"},
+		{name: "other host", from: "example.com/docs/a.html", to: "cdn.example.com/x.js", u: "https://cdn.example.com/x.js", want: "../../cdn.example.com/x.js"},
+		{name: "same file", from: "example.com/docs/a.html", to: "example.com/docs/a.html", u: "https://example.com/docs/a#Foo", want: "a.html#Foo"},
+		{name: "query and fragment", from: "example.com/a.html", to: "example.com/b.html", u: "https://example.com/b?x=1#y", want: "b.html?x=1#y"},
+		{name: "escaped", from: "example.com/a.html", to: "example.com/a b.html", u: "https://example.com/a%20b", want: "a%20b.html"},
+		{name: "colon in the first segment", from: "a.html", to: "localhost:8080/b.html", u: "http://localhost:8080/b", want: "./localhost:8080/b.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := relativeLink(tt.from, tt.to, mustParseURL(t, tt.u))
+			if got != tt.want {
+				t.Errorf("relativeLink() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadable(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/a":     true,
+		"http://example.com/a":      true,
+		"file://localhost/a.html":   true,
+		"HTTPS://example.com/a":     true,
+		"mailto:a@example.com":      false,
+		"javascript:void(0)":        false,
+		"data:image/png;base64,AA":  false,
+		"ftp://example.com/a":       false,
+		"/a.html":                   false,
+		"dash-apple-api://load?x=1": false,
+	}
+	for raw, want := range tests {
+		if got := downloadable(mustParseURL(t, raw)); got != want {
+			t.Errorf("downloadable(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package dashdog
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+type LinkPolicyAction string
+
+const (
+	LinkPolicyAsset  LinkPolicyAction = "asset"  // download as a resource
+	LinkPolicyPage   LinkPolicyAction = "page"   // crawl as a sub page if it is in the scope, or point to the online page
+	LinkPolicyEmbed  LinkPolicyAction = "embed"  // populate as a part of the page whatever the depth if it is in the scope, or download as a resource
+	LinkPolicyOnline LinkPolicyAction = "online" // point to the online url
+	LinkPolicyDrop   LinkPolicyAction = "drop"   // remove the attr
+)
+
+// defaultLinkPolicies are matched after the link policies of the config
+var defaultLinkPolicies = []LinkPolicy{
+	{Element: "link", Rel: "stylesheet", Action: LinkPolicyAsset},
+	{Element: "link", Rel: "canonical", Action: LinkPolicyOnline},
+	{Element: "link", Rel: "alternate", Action: LinkPolicyOnline},
+	{Element: "link", Rel: "search", Action: LinkPolicyOnline},
+	{Element: "link", Rel: "preconnect", Action: LinkPolicyDrop},
+	{Element: "link", Rel: "dns-prefetch", Action: LinkPolicyDrop},
+	{Element: "iframe", Action: LinkPolicyEmbed},
+	{Element: "a", Action: LinkPolicyPage},
+	{Element: "*", Action: LinkPolicyAsset},
+}
+
+func checkLinkPolicies(policies []LinkPolicy) error {
+	for _, policy := range policies {
+		if policy.Element == "" {
+			return errors.Errorf("empty element of link policy %+v", policy)
+		}
+		switch policy.Action {
+		case LinkPolicyAsset, LinkPolicyPage, LinkPolicyEmbed, LinkPolicyOnline, LinkPolicyDrop:
+		default:
+			return errors.Errorf("invalid link policy action %s", policy.Action)
+		}
+	}
+	return nil
+}
+
+// newLinkPolicies returns the link policies of the config followed by the default ones
+func newLinkPolicies(config []LinkPolicy) []LinkPolicy {
+	policies := make([]LinkPolicy, 0, len(config)+len(defaultLinkPolicies))
+	policies = append(policies, config...)
+	return append(policies, defaultLinkPolicies...)
+}
+
+// match reports whether the policy applies to node
+func (p LinkPolicy) match(node *html.Node) bool {
+	if p.Element != "*" && !strings.EqualFold(p.Element, node.Data) {
+		return false
+	}
+	if p.Rel == "" {
+		return true
+	}
+	for _, rel := range strings.Fields(attr(node, "rel")) {
+		if strings.EqualFold(rel, p.Rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkPolicy returns the action of the first policy matching the href/src of node
+func (d Dash) linkPolicy(node *html.Node) LinkPolicyAction {
+	for _, policy := range d.linkPolicies {
+		if policy.match(node) {
+			return policy.Action
+		}
+	}
+	return LinkPolicyAsset
+}
+
+// removeAttr removes the attrs of node with key
+func removeAttr(node *html.Node, key string) {
+	attrs := node.Attr[:0]
+	for _, a := range node.Attr {
+		if a.Key != key {
+			attrs = append(attrs, a)
+		}
+	}
+	node.Attr = attrs
+}
@@ -0,0 +1,136 @@
+package dashdog
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestLinkPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		config []LinkPolicy
+		html   string
+		want   LinkPolicyAction
+	}{
+		{name: "stylesheet", html: `<link rel="stylesheet" href="a.css">`, want: LinkPolicyAsset},
+		{name: "one of the rels", html: `<link rel="preload stylesheet" href="a.css">`, want: LinkPolicyAsset},
+		{name: "canonical", html: `<link rel="canonical" href="/a">`, want: LinkPolicyOnline},
+		{name: "rel is case insensitive", html: `<link rel="Canonical" href="/a">`, want: LinkPolicyOnline},
+		{name: "preconnect", html: `<link rel="preconnect" href="https://cdn.example.com">`, want: LinkPolicyDrop},
+		{name: "unknown rel", html: `<link rel="icon" href="a.ico">`, want: LinkPolicyAsset},
+		{name: "a", html: `<a href="a.html">a</a>`, want: LinkPolicyPage},
+		{name: "iframe", html: `<iframe src="a.html"></iframe>`, want: LinkPolicyEmbed},
+		{name: "img", html: `<img src="a.png">`, want: LinkPolicyAsset},
+		{name: "the config wins", config: []LinkPolicy{{Element: "iframe", Action: LinkPolicyOnline}}, html: `<iframe src="a.html"></iframe>`, want: LinkPolicyOnline},
+		{name: "the config with rel", config: []LinkPolicy{{Element: "link", Rel: "prev", Action: LinkPolicyOnline}}, html: `<link rel="prev" href="/a">`, want: LinkPolicyOnline},
+		{name: "the config with another rel", config: []LinkPolicy{{Element: "link", Rel: "prev", Action: LinkPolicyOnline}}, html: `<link rel="icon" href="a.ico">`, want: LinkPolicyAsset},
+		{name: "the config of every element", config: []LinkPolicy{{Element: "*", Action: LinkPolicyDrop}}, html: `<a href="a.html">a</a>`, want: LinkPolicyDrop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("html.Parse: %v", err)
+			}
+			var node *html.Node
+			var find func(n *html.Node)
+			find = func(n *html.Node) {
+				if n.Type == html.ElementNode && (attr(n, "href") != "" || attr(n, "src") != "") {
+					node = n
+					return
+				}
+				for c := n.FirstChild; c != nil && node == nil; c = c.NextSibling {
+					find(c)
+				}
+			}
+			find(doc)
+
+			d := Dash{linkPolicies: newLinkPolicies(tt.config)}
+			if got := d.linkPolicy(node); got != tt.want {
+				t.Errorf("linkPolicy() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLinkPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []LinkPolicy
+		wantErr  bool
+	}{
+		{name: "empty", policies: nil},
+		{name: "every action", policies: []LinkPolicy{
+			{Element: "a", Action: LinkPolicyAsset},
+			{Element: "a", Action: LinkPolicyPage},
+			{Element: "a", Action: LinkPolicyEmbed},
+			{Element: "a", Action: LinkPolicyOnline},
+			{Element: "a", Action: LinkPolicyDrop},
+		}},
+		{name: "no element", policies: []LinkPolicy{{Action: LinkPolicyOnline}}, wantErr: true},
+		{name: "invalid action", policies: []LinkPolicy{{Element: "a", Action: "skip"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkLinkPolicies(tt.policies); (err != nil) != tt.wantErr {
+				t.Errorf("checkLinkPolicies() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmbeddedIframe(t *testing.T) {
+	other := newTestSite(t, map[string]string{
+		"/widget": "<html><body>widget</body></html>",
+	})
+	srv := newTestSite(t, map[string]string{
+		"/docs/": `<html><head></head><body>
+<iframe src="example.html"></iframe>
+<iframe src="` + other.URL + `/widget"></iframe>
+<a href="sub.html">sub</a>
+</body></html>`,
+		"/docs/example.html": `<html><head></head><body><img src="a.png"><a href="sub.html">sub</a></body></html>`,
+		"/docs/a.png":        "png",
+		"/docs/sub.html":     "<html><body>sub</body></html>",
+	})
+	host := mustParseURL(t, srv.URL).Host
+	otherHost := mustParseURL(t, other.URL).Host
+
+	// the depth is 1, only the page and the embedded pages are local
+	d, err := buildTestDocset(t, Config{URL: srv.URL + "/docs/"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	got := readDocument(t, d, host+"/docs/index.html")
+	for _, want := range []string{
+		`<iframe src="example.html"></iframe>`,
+		`<iframe src="../../` + otherHost + `/widget.html"></iframe>`,
+		`<a href="` + srv.URL + `/docs/sub.html">sub</a>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("the page does not contain %s:\n%s", want, got)
+		}
+	}
+
+	// the embedded page is populated as the page
+	example := readDocument(t, d, host+"/docs/example.html")
+	for _, want := range []string{
+		`<img src="a.png"/>`,
+		`<a href="` + srv.URL + `/docs/sub.html">sub</a>`,
+	} {
+		if !strings.Contains(example, want) {
+			t.Errorf("the embedded page does not contain %s:\n%s", want, example)
+		}
+	}
+	if !documentExists(d, host+"/docs/a.png") {
+		t.Errorf("the resource of the embedded page is not downloaded")
+	}
+	if documentExists(d, host+"/docs/sub.html") {
+		t.Errorf("the sub page is downloaded at depth 1")
+	}
+}
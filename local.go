@@ -0,0 +1,145 @@
+package dashdog
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// localHost is the host of the local files, a local file is fetched as file://localhost/<path relative to the source dir>,
+// so the local files are laid out in the docset the same as the pages of a site
+const localHost = "localhost"
+
+// localSource returns the source dir and the seed url of rawURL for a local build,
+// the source dir is empty if it is not a local build
+func localSource(sourceDir, rawURL string) (string, string, error) {
+	var root, index string
+
+	if sourceDir != "" {
+		root = os.ExpandEnv(sourceDir)
+		index = "index.html"
+		if rawURL != "" {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				return "", "", errors.Wrapf(err, "Parse %s", rawURL)
+			}
+			switch u.Scheme {
+			case "":
+				index = u.Path
+			case "file":
+				abs, err := filepath.Abs(root)
+				if err != nil {
+					return "", "", errors.Wrapf(err, "Abs %s", root)
+				}
+				rel, err := filepath.Rel(abs, filepath.FromSlash(u.Path))
+				if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					return "", "", errors.Errorf("%s is not in the source dir %s", rawURL, sourceDir)
+				}
+				index = filepath.ToSlash(rel)
+			default:
+				return "", "", errors.Errorf("url %s must be a file in the source dir %s", rawURL, sourceDir)
+			}
+		}
+	} else {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "Parse %s", rawURL)
+		}
+		if u.Scheme != "file" {
+			return "", "", nil
+		}
+		if u.Host != "" && u.Host != localHost {
+			return "", "", errors.Errorf("url %s is not a local file", rawURL)
+		}
+		// the files in the dir of the seed can be read
+		if strings.HasSuffix(u.Path, "/") {
+			root = u.Path
+		} else {
+			root, index = path.Split(u.Path)
+		}
+		root = filepath.FromSlash(root)
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "Abs %s", root)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "Stat %s", root)
+	}
+	if !info.IsDir() {
+		return "", "", errors.Errorf("%s is not a dir", root)
+	}
+
+	seed := &url.URL{
+		Scheme: "file",
+		Host:   localHost,
+		Path:   path.Join("/", index),
+	}
+	if strings.HasSuffix(index, "/") && seed.Path != "/" {
+		seed.Path += "/"
+	}
+	return root, seed.String(), nil
+}
+
+// isLocal reports whether u is a local file
+func isLocal(u *url.URL) bool {
+	return u.Scheme == "file"
+}
+
+// readFile reads the local file of u like a static file server, the index.html is read for a dir,
+// the Content-Type is inferred from the file extension
+func (f *fetcher) readFile(u *url.URL) (*response, error) {
+	if f.sourceDir == "" || u.Host != localHost {
+		// never read the local files for a remote page
+		slog.Warn("local file is not allowed", slog.String("url", u.String()))
+		return newLocalResponse(http.StatusNotFound, "", nil), nil
+	}
+
+	// Clean the rooted path, so that we never go out of the source dir
+	name := filepath.Join(f.sourceDir, filepath.FromSlash(path.Clean("/"+u.Path)))
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return newLocalResponse(http.StatusNotFound, "", nil), nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Stat %s", name)
+	}
+	if info.IsDir() {
+		name = filepath.Join(name, "index.html")
+	}
+
+	body, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return newLocalResponse(http.StatusNotFound, "", nil), nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "ReadFile %s", name)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	return newLocalResponse(http.StatusOK, contentType, body), nil
+}
+
+func newLocalResponse(statusCode int, contentType string, body []byte) *response {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &response{
+		statusCode: statusCode,
+		status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		header:     header,
+		body:       body,
+	}
+}
@@ -0,0 +1,86 @@
+package dashdog
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultPorts are the ports removed from the host by the default port normalization
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+func checkNormalize(config Normalize) error {
+	for _, pattern := range config.StripParams {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid strip param %s", pattern)
+		}
+	}
+	return nil
+}
+
+// normalizeURL returns a copy of u normalized as config, so the urls of the same page are downloaded only once
+func normalizeURL(config Normalize, u *url.URL) *url.URL {
+	nu := *u
+
+	if config.LowerHost {
+		nu.Host = strings.ToLower(nu.Host)
+	}
+	if config.RemoveDefaultPort {
+		if host, port, err := net.SplitHostPort(nu.Host); err == nil && defaultPorts[strings.ToLower(nu.Scheme)] == port {
+			nu.Host = host
+			if strings.Contains(host, ":") {
+				// ipv6
+				nu.Host = "[" + host + "]"
+			}
+		}
+	}
+
+	if config.LowerPath {
+		nu.Path = strings.ToLower(nu.Path)
+		nu.RawPath = ""
+	}
+	for _, index := range config.IndexDocuments {
+		dir, file := path.Split(nu.Path)
+		if file == index {
+			nu.Path = dir
+			nu.RawPath = ""
+			break
+		}
+	}
+	if config.StripTrailingSlash && len(nu.Path) > 1 && strings.HasSuffix(nu.Path, "/") {
+		nu.Path = strings.TrimRight(nu.Path, "/")
+		if nu.Path == "" {
+			nu.Path = "/"
+		}
+		nu.RawPath = ""
+	}
+
+	if len(config.StripParams) > 0 && nu.RawQuery != "" {
+		query := nu.Query()
+		stripped := false
+		for key := range query {
+			for _, pattern := range config.StripParams {
+				if ok, _ := path.Match(pattern, key); ok {
+					delete(query, key)
+					stripped = true
+					break
+				}
+			}
+		}
+		if stripped {
+			nu.RawQuery = query.Encode()
+		}
+	}
+	return &nu
+}
+
+// normalize normalizes u as the config
+func (d Dash) normalize(u *url.URL) *url.URL {
+	return normalizeURL(d.config.Normalize, u)
+}
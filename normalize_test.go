@@ -0,0 +1,99 @@
+package dashdog
+
+import "testing"
+
+func TestCheckNormalize(t *testing.T) {
+	if err := checkNormalize(Normalize{StripParams: []string{"utm_*", "ref"}}); err != nil {
+		t.Errorf("checkNormalize() err = %v", err)
+	}
+	if err := checkNormalize(Normalize{StripParams: []string{"utm_["}}); err == nil {
+		t.Errorf("checkNormalize() with an invalid pattern err = nil")
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Normalize
+		url    string
+		want   string
+	}{
+		{name: "nothing", url: "HTTPS://Example.COM:443/PKG/index.html/?b=2&a=1#Foo", want: "https://Example.COM:443/PKG/index.html/?b=2&a=1#Foo"},
+
+		{name: "lower host", config: Normalize{LowerHost: true}, url: "https://Example.COM/PKG", want: "https://example.com/PKG"},
+		{name: "lower host with port", config: Normalize{LowerHost: true}, url: "https://Example.COM:8443/", want: "https://example.com:8443/"},
+
+		{name: "remove https port", config: Normalize{RemoveDefaultPort: true}, url: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "remove http port", config: Normalize{RemoveDefaultPort: true}, url: "http://example.com:80/a", want: "http://example.com/a"},
+		{name: "keep another port", config: Normalize{RemoveDefaultPort: true}, url: "https://example.com:80/a", want: "https://example.com:80/a"},
+		{name: "keep a non default port", config: Normalize{RemoveDefaultPort: true}, url: "http://example.com:8080/a", want: "http://example.com:8080/a"},
+		{name: "no port", config: Normalize{RemoveDefaultPort: true}, url: "https://example.com/a", want: "https://example.com/a"},
+		{name: "ipv6", config: Normalize{RemoveDefaultPort: true}, url: "http://[::1]:80/a", want: "http://[::1]/a"},
+		{name: "upper scheme", config: Normalize{RemoveDefaultPort: true}, url: "HTTPS://example.com:443/a", want: "https://example.com/a"},
+
+		{name: "lower path", config: Normalize{LowerPath: true}, url: "https://Example.com/PKG/Foo.html", want: "https://Example.com/pkg/foo.html"},
+		{name: "lower escaped path", config: Normalize{LowerPath: true}, url: "https://example.com/A%2FB", want: "https://example.com/a/b"},
+
+		{name: "index document", config: Normalize{IndexDocuments: []string{"index.html"}}, url: "https://example.com/pkg/index.html", want: "https://example.com/pkg/"},
+		{name: "root index document", config: Normalize{IndexDocuments: []string{"index.html"}}, url: "https://example.com/index.html", want: "https://example.com/"},
+		{name: "another index document", config: Normalize{IndexDocuments: []string{"index.html", "index.htm"}}, url: "https://example.com/pkg/index.htm", want: "https://example.com/pkg/"},
+		{name: "not an index document", config: Normalize{IndexDocuments: []string{"index.html"}}, url: "https://example.com/pkg/myindex.html", want: "https://example.com/pkg/myindex.html"},
+
+		{name: "strip trailing slash", config: Normalize{StripTrailingSlash: true}, url: "https://example.com/pkg/", want: "https://example.com/pkg"},
+		{name: "strip trailing slashes", config: Normalize{StripTrailingSlash: true}, url: "https://example.com/pkg//", want: "https://example.com/pkg"},
+		{name: "keep the root", config: Normalize{StripTrailingSlash: true}, url: "https://example.com/", want: "https://example.com/"},
+		{name: "no trailing slash", config: Normalize{StripTrailingSlash: true}, url: "https://example.com/pkg", want: "https://example.com/pkg"},
+		{
+			name:   "index document then trailing slash",
+			config: Normalize{IndexDocuments: []string{"index.html"}, StripTrailingSlash: true},
+			url:    "https://example.com/pkg/index.html",
+			want:   "https://example.com/pkg",
+		},
+
+		{name: "strip params", config: Normalize{StripParams: []string{"utm_*"}}, url: "https://example.com/a?utm_source=x&b=2&utm_medium=y", want: "https://example.com/a?b=2"},
+		{name: "strip every param", config: Normalize{StripParams: []string{"utm_*"}}, url: "https://example.com/a?utm_source=x", want: "https://example.com/a"},
+		{name: "strip an exact param", config: Normalize{StripParams: []string{"ref"}}, url: "https://example.com/a?ref=x&refs=y", want: "https://example.com/a?refs=y"},
+		// the query is sorted by the keys only if it is rewritten
+		{name: "sort the stripped query", config: Normalize{StripParams: []string{"ref"}}, url: "https://example.com/a?b=2&ref=x&a=1", want: "https://example.com/a?a=1&b=2"},
+		{name: "keep the order of the query", config: Normalize{StripParams: []string{"ref"}}, url: "https://example.com/a?b=2&a=1", want: "https://example.com/a?b=2&a=1"},
+
+		// the fragment is a part of the link, it is removed from the key to download only
+		{
+			name:   "keep the fragment",
+			config: Normalize{LowerHost: true, IndexDocuments: []string{"index.html"}, StripParams: []string{"utm_*"}},
+			url:    "https://Example.com/pkg/index.html?utm_source=x#Foo",
+			want:   "https://example.com/pkg/#Foo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := mustParseURL(t, tt.url)
+			raw := u.String()
+			got := normalizeURL(tt.config, u)
+			if got.String() != tt.want {
+				t.Errorf("normalizeURL() = %s, want %s", got, tt.want)
+			}
+			// a copy is returned
+			if u.String() != raw {
+				t.Errorf("the url is modified to %s", u)
+			}
+		})
+	}
+}
+
+func TestFetchKey(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/a":          "https://example.com/a",
+		"https://example.com/a#Foo":      "https://example.com/a",
+		"https://example.com/a?x=1#Foo":  "https://example.com/a?x=1",
+		"https://example.com/a#%2Fpath":  "https://example.com/a",
+		"file://localhost/a.html#Foo":    "file://localhost/a.html",
+		"https://example.com/a?b=2&a=1#": "https://example.com/a?b=2&a=1",
+	}
+	for raw, want := range tests {
+		if got := fetchKey(mustParseURL(t, raw)); got != want {
+			t.Errorf("fetchKey(%s) = %s, want %s", raw, got, want)
+		}
+	}
+}
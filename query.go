@@ -0,0 +1,77 @@
+package dashdog
+
+import (
+	"net/url"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+type QueryPolicy string
+
+const (
+	QueryPolicyDrop QueryPolicy = "drop" // ignore the query, the urls with different queries are the same file
+	QueryPolicyHash QueryPolicy = "hash" // hash the query into the file name
+	QueryPolicyKeep QueryPolicy = "keep" // hash only the query keys in the allowlist into the file name
+)
+
+// queryTagLength is how many hex chars of the query hash are in the file name
+const queryTagLength = 8
+
+func checkQuery(config Query) error {
+	switch config.Policy {
+	case "", QueryPolicyDrop, QueryPolicyHash, QueryPolicyKeep:
+		return nil
+	default:
+		return errors.Errorf("invalid query policy %s", config.Policy)
+	}
+}
+
+// queryTag returns the tag of the query of u to put in the file name, it is empty if the query is ignored
+func queryTag(config Query, u *url.URL) string {
+	query := u.Query()
+	switch config.Policy {
+	case QueryPolicyHash:
+	case QueryPolicyKeep:
+		kept := url.Values{}
+		for _, key := range config.Keys {
+			if values, ok := query[key]; ok {
+				kept[key] = values
+			}
+		}
+		query = kept
+	default:
+		return ""
+	}
+
+	if len(query) == 0 {
+		return ""
+	}
+	// Encode sorts the keys, so the order of the keys does not matter
+	return contentHash([]byte(query.Encode()))[:queryTagLength]
+}
+
+// tagPath inserts the tag before the extension of the last segment of p, e.g. /a/style.css => /a/style-1a2b3c4d.css
+func tagPath(p, tag string) string {
+	if tag == "" {
+		return p
+	}
+	dir, file := path.Split(p)
+	ext := path.Ext(file)
+	return dir + file[:len(file)-len(ext)] + "-" + tag + ext
+}
+
+// newFetchItem creates the item of u, the query of u is tagged as the query policy,
+// and the resource is named by its content if the shared assets are enabled
+func (d Dash) newFetchItem(u *url.URL, level int, needPopulate bool, task *fetchTask) (*fetchItem, error) {
+	item, err := newFetchItem(u, level, needPopulate, task)
+	if err != nil {
+		return nil, err
+	}
+	d.canonicalize(item)
+	item.queryTag = queryTag(d.config.Query, item.u)
+	if d.config.SharedAssets {
+		item.assetHash = assetHash(item)
+	}
+	return item, nil
+}
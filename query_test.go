@@ -0,0 +1,111 @@
+package dashdog
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestQueryTag(t *testing.T) {
+	hashOf := func(query string) string {
+		return contentHash([]byte(query))[:queryTagLength]
+	}
+
+	tests := []struct {
+		name   string
+		config Query
+		u      string
+		want   string
+	}{
+		{name: "default drops the query", config: Query{}, u: "https://example.com/a.css?v=1", want: ""},
+		{name: "drop", config: Query{Policy: QueryPolicyDrop}, u: "https://example.com/a.css?v=1", want: ""},
+		{name: "hash", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/a.css?v=1", want: hashOf("v=1")},
+		{name: "hash without query", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/a.css", want: ""},
+		{name: "hash empty query", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/a.css?", want: ""},
+		{name: "hash sorts the keys", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/a?b=2&a=1", want: hashOf("a=1&b=2")},
+		{name: "hash keeps the order of the values", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/a?a=2&a=1", want: hashOf("a=2&a=1")},
+		{name: "hash decodes the values", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/a?q=a%20b", want: hashOf("q=a+b")},
+		{name: "keep the allowed keys", config: Query{Policy: QueryPolicyKeep, Keys: []string{"pkg"}}, u: "https://example.com/a?pkg=x&utm_source=y", want: hashOf("pkg=x")},
+		{name: "keep without allowed keys", config: Query{Policy: QueryPolicyKeep, Keys: []string{"pkg"}}, u: "https://example.com/a?utm_source=y", want: ""},
+		{name: "keep no keys", config: Query{Policy: QueryPolicyKeep}, u: "https://example.com/a?pkg=x", want: ""},
+		{name: "keep several keys", config: Query{Policy: QueryPolicyKeep, Keys: []string{"v", "pkg"}}, u: "https://example.com/a?v=1&x=0&pkg=x", want: hashOf("pkg=x&v=1")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryTag(tt.config, mustParseURL(t, tt.u)); got != tt.want {
+				t.Errorf("queryTag(%s) = %q, want %q", tt.u, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryTagSameQuery(t *testing.T) {
+	config := Query{Policy: QueryPolicyHash}
+	a := queryTag(config, &url.URL{Path: "/a", RawQuery: "x=1&y=2"})
+	b := queryTag(config, &url.URL{Path: "/a", RawQuery: "y=2&x=1"})
+	c := queryTag(config, &url.URL{Path: "/a", RawQuery: "x=1&y=3"})
+	if a != b {
+		t.Errorf("the same query in another order gets another tag: %s != %s", a, b)
+	}
+	if a == c {
+		t.Errorf("another query gets the same tag %s", a)
+	}
+}
+
+func TestCheckQuery(t *testing.T) {
+	for _, policy := range []QueryPolicy{"", QueryPolicyDrop, QueryPolicyHash, QueryPolicyKeep} {
+		if err := checkQuery(Query{Policy: policy}); err != nil {
+			t.Errorf("checkQuery(%q) err = %v", policy, err)
+		}
+	}
+	if err := checkQuery(Query{Policy: "sort"}); err == nil {
+		t.Errorf("checkQuery(sort) accepts an invalid policy")
+	}
+}
+
+func TestTagPath(t *testing.T) {
+	tests := []struct {
+		p    string
+		tag  string
+		want string
+	}{
+		{p: "/a/style.css", tag: "", want: "/a/style.css"},
+		{p: "/a/style.css", tag: "1a2b3c4d", want: "/a/style-1a2b3c4d.css"},
+		{p: "/a/jquery.min.js", tag: "1a2b3c4d", want: "/a/jquery.min-1a2b3c4d.js"},
+		{p: "/a/search", tag: "1a2b3c4d", want: "/a/search-1a2b3c4d"},
+		{p: "/a.b/search", tag: "1a2b3c4d", want: "/a.b/search-1a2b3c4d"},
+		{p: "/a/index", tag: "1a2b3c4d", want: "/a/index-1a2b3c4d"},
+	}
+
+	for _, tt := range tests {
+		if got := tagPath(tt.p, tt.tag); got != tt.want {
+			t.Errorf("tagPath(%s, %s) = %s, want %s", tt.p, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestLocalPathWithQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Query
+		u      string
+		suffix string
+		want   string
+	}{
+		{name: "drop", config: Query{Policy: QueryPolicyDrop}, u: "https://example.com/a/style.css?v=1", want: "example.com/a/style.css"},
+		{name: "hash", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/a/style.css?v=1", want: "example.com/a/style-" + contentHash([]byte("v=1"))[:queryTagLength] + ".css"},
+		{name: "hash a page", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/search?q=a", suffix: ".html", want: "example.com/search-" + contentHash([]byte("q=a"))[:queryTagLength] + ".html"},
+		{name: "hash the index of a dir", config: Query{Policy: QueryPolicyHash}, u: "https://example.com/pkg/?tab=doc", suffix: ".html", want: "example.com/pkg/index-" + contentHash([]byte("tab=doc"))[:queryTagLength] + ".html"},
+		{name: "keep another key", config: Query{Policy: QueryPolicyKeep, Keys: []string{"pkg"}}, u: "https://example.com/a/style.css?v=1", want: "example.com/a/style.css"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := fetchItem{u: mustParseURL(t, tt.u), suffix: tt.suffix}
+			item.queryTag = queryTag(tt.config, item.u)
+			if got := item.localPath(); got != tt.want {
+				t.Errorf("localPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
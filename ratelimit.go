@@ -0,0 +1,138 @@
+package dashdog
+
+import (
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+const defaultUserAgent = "dashdog (+https://github.com/tenfyzhong/dashdog)"
+
+// hostLimiter spaces the requests to a host, it is a token bucket implemented as GCRA
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // the time to refill a token, 0 means no rate limit
+	burst    int
+	minDelay time.Duration
+
+	tat  time.Time // the theoretical arrival time of the next request
+	last time.Time // the start time of the last request
+}
+
+func newHostLimiter(limit HostRateLimit) *hostLimiter {
+	l := &hostLimiter{
+		burst:    limit.Burst,
+		minDelay: limit.MinDelay,
+	}
+	if limit.RequestsPerSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / limit.RequestsPerSecond)
+	}
+	if l.burst <= 0 {
+		l.burst = 1
+	}
+	return l
+}
+
+// reserve reserves a slot for a request and returns how long to wait before sending it
+func (l *hostLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := now
+	if l.interval > 0 {
+		tat := l.tat
+		if tat.Before(now) {
+			tat = now
+		}
+		tolerance := time.Duration(l.burst-1) * l.interval
+		if allow := tat.Add(-tolerance); allow.After(start) {
+			start = allow
+		}
+	}
+	if l.minDelay > 0 && !l.last.IsZero() {
+		if allow := l.last.Add(l.minDelay); allow.After(start) {
+			start = allow
+		}
+	}
+
+	if l.interval > 0 {
+		if l.tat.Before(start) {
+			l.tat = start
+		}
+		l.tat = l.tat.Add(l.interval)
+	}
+	l.last = start
+	return start.Sub(now)
+}
+
+// raiseMinDelay makes the min delay at least delay
+func (l *hostLimiter) raiseMinDelay(delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if delay > l.minDelay {
+		l.minDelay = delay
+	}
+}
+
+// rateLimiter limits the requests of every host, it is safe for concurrent use
+type rateLimiter struct {
+	config RateLimit
+
+	mu       sync.Mutex
+	limiters map[string]*hostLimiter
+}
+
+func newRateLimiter(config RateLimit) *rateLimiter {
+	return &rateLimiter{
+		config:   config,
+		limiters: map[string]*hostLimiter{},
+	}
+}
+
+func (r *rateLimiter) limiter(host string) *hostLimiter {
+	host = strings.ToLower(host)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.limiters[host]; ok {
+		return l
+	}
+
+	limit, ok := r.config.Hosts[host]
+	if !ok {
+		limit = r.config.HostRateLimit
+	}
+	l := newHostLimiter(limit)
+	r.limiters[host] = l
+	return l
+}
+
+// wait blocks until a request to the host of req can be sent, it is called before every attempt of a request
+func (r *rateLimiter) wait(_ *resty.Client, req *resty.Request) error {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return errors.Wrapf(err, "Parse %s", req.URL)
+	}
+
+	delay := r.limiter(u.Host).reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+	slog.Debug("rate limit", slog.String("url", req.URL), slog.Duration("delay", delay))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
@@ -0,0 +1,143 @@
+package dashdog
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	css "github.com/andybalholm/cascadia"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// maxMetaRefreshes is how many `<meta http-equiv=refresh>` pages are followed at most for a url, the same as the http redirects
+const maxMetaRefreshes = 10
+
+// redirectStubTpl is the page written to the local file of a redirected url, %[1]s is the link to the final page
+const redirectStubTpl = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"/><meta http-equiv="refresh" content="0; url=%[1]s"/><link rel="canonical" href="%[1]s"/></head>
+<body><a href="%[1]s">%[1]s</a></body></html>
+`
+
+// metaRefreshURL returns the url of the `<meta http-equiv=refresh>` of the html body, it is empty if there is none
+func metaRefreshURL(body []byte) string {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	for _, node := range css.MustCompile("meta[http-equiv][content]").MatchAll(doc) {
+		if !strings.EqualFold(strings.TrimSpace(attr(node, "http-equiv")), "refresh") {
+			continue
+		}
+		// content is like `0; url='index.html'`, the url is optional
+		_, ref, ok := strings.Cut(attr(node, "content"), ";")
+		if !ok {
+			_, ref, ok = strings.Cut(attr(node, "content"), ",")
+		}
+		if !ok {
+			continue
+		}
+		ref = strings.TrimSpace(ref)
+		if len(ref) >= 3 && strings.EqualFold(ref[:3], "url") {
+			if rest := strings.TrimSpace(ref[3:]); strings.HasPrefix(rest, "=") {
+				ref = strings.TrimSpace(rest[1:])
+			}
+		}
+		ref = strings.Trim(ref, `'"`)
+		if ref != "" {
+			return ref
+		}
+	}
+	return ""
+}
+
+// followMetaRefresh downloads the page the `<meta http-equiv=refresh>` of resp redirects to,
+// the location of the returned response is the final url
+func (f *fetcher) followMetaRefresh(u *url.URL, resp *response) (*response, error) {
+	for i := 0; i < maxMetaRefreshes; i++ {
+		if resp.StatusCode() != http.StatusOK || !strings.Contains(resp.Header().Get("Content-Type"), "text/html") {
+			return resp, nil
+		}
+		ref := metaRefreshURL(resp.Body())
+		if ref == "" {
+			return resp, nil
+		}
+
+		base := u
+		if resp.location != nil {
+			base = resp.location
+		}
+		target, ok, err := resolveLink(base, ref)
+		if err != nil || !ok {
+			slog.Debug("ignore meta refresh", slog.String("url", base.String()), slog.String("refresh", ref))
+			return resp, nil
+		}
+		target.Fragment = ""
+		target.RawFragment = ""
+		if fetchKey(target) == fetchKey(base) {
+			return resp, nil
+		}
+
+		slog.Debug("meta refresh", slog.String("from", base.String()), slog.String("to", target.String()))
+		next, err := f.get(target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "meta refresh from %s", base.String())
+		}
+		if next.location == nil {
+			next.location = target
+		}
+		resp = next
+	}
+	return resp, nil
+}
+
+// canonicalize normalizes the final url of a redirected item, the item is not redirected if they are the same
+func (d Dash) canonicalize(item *fetchItem) {
+	if item.alias == nil {
+		return
+	}
+	item.u = d.normalize(item.u)
+	if fetchKey(item.u) == fetchKey(item.alias) {
+		item.u = item.alias
+		item.alias = nil
+		return
+	}
+	slog.Debug("redirect", slog.String("from", item.alias.String()), slog.String("to", item.u.String()))
+}
+
+// writeRedirectStub writes a page to the local file of the alias of item, it redirects to the local file of item
+func (d *Dash) writeRedirectStub(item *fetchItem) error {
+	if !item.needPopulate || item.resp.StatusCode() != http.StatusOK {
+		return nil
+	}
+
+	alias := &fetchItem{
+		u:        item.alias,
+		queryTag: queryTag(d.config.Query, item.alias),
+	}
+	alias.adjustSuffix(item.resp.Header().Get("Content-Type"))
+	aliasPath := alias.localPath()
+	if aliasPath == item.localPath() {
+		return nil
+	}
+
+	link := relativeLink(aliasPath, item.localPath(), &url.URL{})
+	body := []byte(fmt.Sprintf(redirectStubTpl, html.EscapeString(link)))
+	record := &fileRecord{
+		URL:         item.alias.String(),
+		ContentType: "text/html; charset=utf-8",
+		Hash:        contentHash(body),
+		Level:       item.level,
+		Alias:       item.u.String(),
+	}
+	if !d.state.addFile(aliasPath, record) {
+		return nil
+	}
+
+	slog.Debug("write redirect stub", slog.String("localPath", aliasPath), slog.String("to", link))
+	return errors.Wrapf(d.saveFile(aliasPath, body), "saveFile")
+}
@@ -0,0 +1,133 @@
+package dashdog
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetaRefreshURL(t *testing.T) {
+	tests := []struct {
+		name string
+		meta string
+		want string
+	}{
+		{name: "url", meta: `<meta http-equiv="refresh" content="0; url=new.html">`, want: "new.html"},
+		{name: "no space", meta: `<meta http-equiv="refresh" content="0;url=new.html">`, want: "new.html"},
+		{name: "single quoted", meta: `<meta http-equiv="refresh" content="0; url='new.html'">`, want: "new.html"},
+		{name: "double quoted", meta: `<meta http-equiv="refresh" content='0; url="new.html"'>`, want: "new.html"},
+		{name: "spaces around =", meta: `<meta http-equiv="refresh" content="0; url = new.html ">`, want: "new.html"},
+		{name: "upper url", meta: `<meta http-equiv="refresh" content="0; URL=new.html">`, want: "new.html"},
+		{name: "upper http-equiv", meta: `<meta HTTP-EQUIV="Refresh" content="0; url=new.html">`, want: "new.html"},
+		{name: "delay", meta: `<meta http-equiv="refresh" content="5; url=new.html">`, want: "new.html"},
+		{name: "fractional delay", meta: `<meta http-equiv="refresh" content="0.5; url=new.html">`, want: "new.html"},
+		{name: "comma", meta: `<meta http-equiv="refresh" content="0, url=new.html">`, want: "new.html"},
+		{name: "without url=", meta: `<meta http-equiv="refresh" content="0; new.html">`, want: "new.html"},
+		{name: "absolute url", meta: `<meta http-equiv="refresh" content="0; url=https://example.com/a?b=1">`, want: "https://example.com/a?b=1"},
+		{name: "a path starts with url", meta: `<meta http-equiv="refresh" content="0; urls.html">`, want: "urls.html"},
+		{name: "reload only", meta: `<meta http-equiv="refresh" content="30">`, want: ""},
+		{name: "empty url", meta: `<meta http-equiv="refresh" content="0; url=">`, want: ""},
+		{name: "not refresh", meta: `<meta http-equiv="content-type" content="text/html; charset=utf-8">`, want: ""},
+		{name: "no meta", meta: ``, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf("<html><head>%s</head><body></body></html>", tt.meta)
+			if got := metaRefreshURL([]byte(body)); got != tt.want {
+				t.Errorf("metaRefreshURL(%s) = %q, want %q", tt.meta, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectStubs(t *testing.T) {
+	site := testSiteHandler(map[string]string{
+		"/docs/": `<html><body>
+<a href="old.html">old</a>
+<a href="moved.html">moved</a>
+</body></html>`,
+		"/docs/moved.html":     `<html><head><meta http-equiv="refresh" content="0; URL='pkg/new.html'"></head></html>`,
+		"/docs/pkg/new.html":   "<html><body>new</body></html>",
+		"/docs/pkg/final.html": "<html><body>final</body></html>",
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/docs/old.html" {
+			http.Redirect(w, r, "/docs/pkg/final.html", http.StatusMovedPermanently)
+			return
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	host := mustParseURL(t, srv.URL).Host
+
+	tests := []struct {
+		name        string
+		redirect    Redirect
+		wantLinks   []string
+		wantStubs   map[string]string // the local file of the redirected url => the link to the final page
+		wantNoStubs []string
+	}{
+		{
+			name:     "stubs",
+			redirect: Redirect{MetaRefresh: true, Stubs: true},
+			wantLinks: []string{
+				`<a href="pkg/final.html">old</a>`,
+				`<a href="pkg/new.html">moved</a>`,
+			},
+			wantStubs: map[string]string{"/docs/old.html": "pkg/final.html", "/docs/moved.html": "pkg/new.html"},
+		},
+		{
+			name:     "no stubs",
+			redirect: Redirect{MetaRefresh: true},
+			wantLinks: []string{
+				`<a href="pkg/final.html">old</a>`,
+				`<a href="pkg/new.html">moved</a>`,
+			},
+			wantNoStubs: []string{"/docs/old.html", "/docs/moved.html"},
+		},
+		{
+			// the meta refresh page is saved as is
+			name:     "no meta refresh",
+			redirect: Redirect{Stubs: true},
+			wantLinks: []string{
+				`<a href="pkg/final.html">old</a>`,
+				`<a href="moved.html">moved</a>`,
+			},
+			wantStubs: map[string]string{"/docs/old.html": "pkg/final.html"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := buildTestDocset(t, Config{URL: srv.URL + "/docs/", Depth: 2, Redirect: tt.redirect})
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			got := readDocument(t, d, host+"/docs/index.html")
+			for _, want := range tt.wantLinks {
+				if !strings.Contains(got, want) {
+					t.Errorf("the page does not contain %s:\n%s", want, got)
+				}
+			}
+			for p, link := range tt.wantStubs {
+				stub := readDocument(t, d, host+p)
+				if want := fmt.Sprintf(redirectStubTpl, link); stub != want {
+					t.Errorf("the stub %s =\n%s\nwant\n%s", p, stub, want)
+				}
+				// the stub is followed like any meta refresh page
+				if got := metaRefreshURL([]byte(stub)); got != link {
+					t.Errorf("metaRefreshURL() of the stub %s = %q, want %q", p, got, link)
+				}
+			}
+			for _, p := range tt.wantNoStubs {
+				if documentExists(d, host+p) {
+					t.Errorf("the stub %s is written", p)
+				}
+			}
+		})
+	}
+}
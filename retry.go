@@ -0,0 +1,100 @@
+package dashdog
+
+import (
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+var (
+	defaultRetryStatusCodes = []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	defaultRetryBackoffBase = time.Second
+	defaultRetryBackoffMax  = 30 * time.Second
+)
+
+// setRetry makes client retry a failed request with exponential backoff,
+// a request is failed if it gets a network error or one of the retryable status codes
+func setRetry(client *resty.Client, retry Retry) {
+	if retry.MaxAttempts <= 1 {
+		return
+	}
+
+	// resty cuts every wait to the max wait time, the backoff is capped by ourselves,
+	// so a Retry-After header longer than BackoffMax is honoured
+	client.
+		SetRetryCount(retry.MaxAttempts - 1).
+		SetRetryWaitTime(retry.BackoffBase).
+		SetRetryMaxWaitTime(math.MaxInt64).
+		SetRetryAfter(func(client *resty.Client, resp *resty.Response) (time.Duration, error) {
+			wait, err := retryAfter(client, resp)
+			if err != nil || wait > 0 {
+				return wait, err
+			}
+			return backoff(retry, resp.Request.Attempt), nil
+		}).
+		AddRetryCondition(func(resp *resty.Response, err error) bool {
+			if err != nil {
+				return true
+			}
+			return resp != nil && slices.Contains(retry.StatusCodes, resp.StatusCode())
+		}).
+		AddRetryHook(func(resp *resty.Response, err error) {
+			msg := "retry"
+			attrs := []any{slog.Any("err", err)}
+			if resp != nil {
+				attrs = append(attrs, slog.String("url", resp.Request.URL), slog.Int("status", resp.StatusCode()), slog.Int("attempt", resp.Request.Attempt))
+				// the hook is called after the last attempt too, the request is not retried any more
+				if resp.Request.Attempt >= retry.MaxAttempts {
+					msg = "giving up"
+				}
+			}
+			slog.Warn(msg, attrs...)
+		})
+}
+
+// backoff returns the wait before the next attempt after attempt failed,
+// it is doubled for every retry with a random jitter and capped by BackoffMax
+func backoff(retry Retry, attempt int) time.Duration {
+	wait := retry.BackoffBase
+	for i := 1; i < attempt && wait < retry.BackoffMax; i++ {
+		wait *= 2
+	}
+	if wait > retry.BackoffMax {
+		wait = retry.BackoffMax
+	}
+	// from half of wait to wait like resty, resty raises it to BackoffBase
+	half := wait / 2
+	return half + rand.N(wait-half+1)
+}
+
+// retryAfter returns the wait time in the Retry-After header, it may be in seconds or a http date.
+// It returns 0 to use the exponential backoff if there is no such header.
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	value := strings.TrimSpace(resp.Header().Get("Retry-After"))
+	if value == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, nil
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	if t, err := http.ParseTime(value); err == nil && time.Until(t) > 0 {
+		return time.Until(t), nil
+	}
+	return 0, nil
+}
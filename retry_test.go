@@ -0,0 +1,142 @@
+package dashdog
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "no header", value: "", min: 0, max: 0},
+		{name: "seconds", value: "120", min: 120 * time.Second, max: 120 * time.Second},
+		{name: "zero seconds", value: "0", min: 0, max: 0},
+		{name: "seconds with spaces", value: " 5 ", min: 5 * time.Second, max: 5 * time.Second},
+		{name: "negative seconds", value: "-1", min: 0, max: 0},
+		{name: "http date", value: now.Add(time.Hour).UTC().Format(http.TimeFormat), min: 58 * time.Minute, max: time.Hour},
+		{name: "rfc 850 date", value: now.Add(time.Hour).UTC().Format(time.RFC850), min: 58 * time.Minute, max: time.Hour},
+		{name: "past date", value: now.Add(-time.Hour).UTC().Format(http.TimeFormat), min: 0, max: 0},
+		{name: "invalid", value: "soon", min: 0, max: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			resp := &resty.Response{RawResponse: &http.Response{Header: header}}
+
+			got, err := retryAfter(nil, resp)
+			if err != nil {
+				t.Fatalf("retryAfter() err = %v", err)
+			}
+			if got < tt.min || got > tt.max {
+				t.Errorf("retryAfter(%q) = %v, want in [%v, %v]", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryLog(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	var b bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&b, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	client := resty.New()
+	setRetry(client, Retry{
+		MaxAttempts: 3,
+		BackoffBase: time.Millisecond,
+		BackoffMax:  time.Millisecond,
+		StatusCodes: []int{http.StatusServiceUnavailable},
+	})
+	if _, err := client.R().Get(srv.URL); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if requests != 3 {
+		t.Errorf("requests = %d, want 3", requests)
+	}
+	log := b.String()
+	if got := strings.Count(log, "msg=retry"); got != 2 {
+		t.Errorf("retry logged %d times, want 2:\n%s", got, log)
+	}
+	if got := strings.Count(log, `msg="giving up"`); got != 1 {
+		t.Errorf("giving up logged %d times, want 1:\n%s", got, log)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	retry := Retry{BackoffBase: time.Second, BackoffMax: 30 * time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: time.Second},
+		{attempt: 2, max: 2 * time.Second},
+		{attempt: 3, max: 4 * time.Second},
+		{attempt: 5, max: 16 * time.Second},
+		{attempt: 6, max: 30 * time.Second},
+		{attempt: 100, max: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := backoff(retry, tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("backoff(%d) = %v, want in [%v, %v]", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryAfterLongerThanBackoffMax(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	client := resty.New()
+	setRetry(client, Retry{
+		MaxAttempts: 2,
+		BackoffBase: time.Millisecond,
+		BackoffMax:  10 * time.Millisecond,
+		StatusCodes: []int{http.StatusTooManyRequests},
+	})
+	start := time.Now()
+	resp, err := client.R().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK || requests != 2 {
+		t.Fatalf("status %d after %d requests, want 200 after 2", resp.StatusCode(), requests)
+	}
+	// the Retry-After of the server is honoured, it is not cut to BackoffMax
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want 1s at least", elapsed)
+	}
+}
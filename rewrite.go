@@ -0,0 +1,73 @@
+package dashdog
+
+import (
+	"log/slog"
+	"net/url"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// rewriteRule is a compiled RewriteRule
+type rewriteRule struct {
+	re       *regexp.Regexp
+	replace  string
+	unescape bool
+}
+
+func newRewriteRules(config []RewriteRule) ([]rewriteRule, error) {
+	rules := make([]rewriteRule, 0, len(config))
+	for _, rule := range config {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "regexp.Compile %s", rule.Pattern)
+		}
+		rules = append(rules, rewriteRule{
+			re:       re,
+			replace:  rule.Replace,
+			unescape: rule.Unescape,
+		})
+	}
+	return rules, nil
+}
+
+// rewriteURL applies the rules matching u in order, every rule sees the url rewritten by the previous ones
+func rewriteURL(rules []rewriteRule, u *url.URL) (*url.URL, error) {
+	if len(rules) == 0 {
+		return u, nil
+	}
+
+	raw := u.String()
+	s := raw
+	for _, rule := range rules {
+		if !rule.re.MatchString(s) {
+			continue
+		}
+		s = rule.re.ReplaceAllString(s, rule.replace)
+		if rule.unescape {
+			unescaped, err := url.QueryUnescape(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "QueryUnescape %s", s)
+			}
+			s = unescaped
+		}
+	}
+	if s == raw {
+		return u, nil
+	}
+
+	nu, err := url.Parse(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parse %s rewritten from %s", s, raw)
+	}
+	if !nu.IsAbs() {
+		return nil, errors.Wrapf(ErrUrlInvalid, "%s rewritten from %s", s, raw)
+	}
+	slog.Debug("rewrite", slog.String("from", raw), slog.String("to", s))
+	return nu, nil
+}
+
+// rewrite rewrites u as the rewrite rules of the config
+func (d Dash) rewrite(u *url.URL) (*url.URL, error) {
+	return rewriteURL(d.rewriteRules, u)
+}
@@ -0,0 +1,158 @@
+package dashdog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewRewriteRules(t *testing.T) {
+	if _, err := newRewriteRules([]RewriteRule{{Pattern: `^https://example\.com/(`}}); err == nil {
+		t.Errorf("newRewriteRules() with an invalid pattern err = nil")
+	}
+}
+
+func TestRewriteURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []RewriteRule
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{name: "no rules", url: "https://example.com/latest/a.html", want: "https://example.com/latest/a.html"},
+		{
+			name:  "no match",
+			rules: []RewriteRule{{Pattern: `^https://other\.com/`, Replace: "https://example.com/"}},
+			url:   "https://example.com/latest/a.html",
+			want:  "https://example.com/latest/a.html",
+		},
+		{
+			name:  "pin the version",
+			rules: []RewriteRule{{Pattern: `/latest/`, Replace: "/v2.4/"}},
+			url:   "https://example.com/latest/a.html",
+			want:  "https://example.com/v2.4/a.html",
+		},
+		{
+			name:  "expand the groups",
+			rules: []RewriteRule{{Pattern: `^https://example\.com/docs/([^/]+)/(.*)$`, Replace: "https://$1.example.com/$2"}},
+			url:   "https://example.com/docs/api/a.html",
+			want:  "https://api.example.com/a.html",
+		},
+		{
+			name:  "expand the named group",
+			rules: []RewriteRule{{Pattern: `/(?P<page>\w+)\.htm$`, Replace: "/${page}.html"}},
+			url:   "https://example.com/docs/a.htm",
+			want:  "https://example.com/docs/a.html",
+		},
+		{
+			name: "in order",
+			rules: []RewriteRule{
+				{Pattern: `/latest/`, Replace: "/v2/"},
+				{Pattern: `/v2/`, Replace: "/v2.4/"},
+			},
+			url:  "https://example.com/latest/a.html",
+			want: "https://example.com/v2.4/a.html",
+		},
+		{
+			name: "a later rule does not see the original url",
+			rules: []RewriteRule{
+				{Pattern: `/v2/`, Replace: "/v2.4/"},
+				{Pattern: `/latest/`, Replace: "/v2/"},
+			},
+			url:  "https://example.com/latest/a.html",
+			want: "https://example.com/v2/a.html",
+		},
+		{
+			name:  "redirect shim unescaped",
+			rules: []RewriteRule{{Pattern: `^https://example\.com/go\?to=(.*)$`, Replace: "$1", Unescape: true}},
+			url:   "https://example.com/go?to=https%3A%2F%2Fdocs.example.com%2Fa%3Fx%3D1",
+			want:  "https://docs.example.com/a?x=1",
+		},
+		{
+			name:    "redirect shim escaped",
+			rules:   []RewriteRule{{Pattern: `^https://example\.com/go\?to=(.*)$`, Replace: "$1"}},
+			url:     "https://example.com/go?to=https%3A%2F%2Fdocs.example.com%2Fa",
+			wantErr: true,
+		},
+		{
+			name:    "invalid escape",
+			rules:   []RewriteRule{{Pattern: `^https://example\.com/go\?to=(.*)$`, Replace: "$1", Unescape: true}},
+			url:     "https://example.com/go?to=https%3A%2F%2Fdocs.example.com%2Fa%zz",
+			wantErr: true,
+		},
+		{
+			name:    "relative",
+			rules:   []RewriteRule{{Pattern: `^https://example\.com`, Replace: ""}},
+			url:     "https://example.com/a.html",
+			wantErr: true,
+		},
+		{
+			name:  "another scheme",
+			rules: []RewriteRule{{Pattern: `^https://example\.com/contact$`, Replace: "mailto:a@example.com"}},
+			url:   "https://example.com/contact",
+			want:  "mailto:a@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := newRewriteRules(tt.rules)
+			if err != nil {
+				t.Fatalf("newRewriteRules: %v", err)
+			}
+			u := mustParseURL(t, tt.url)
+			got, err := rewriteURL(rules, u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rewriteURL() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("rewriteURL() = %s, want %s", got, tt.want)
+			}
+			// the url is never modified in place
+			if u.String() != tt.url {
+				t.Errorf("the url is modified to %s", u)
+			}
+		})
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	srv := newTestSite(t, map[string]string{
+		"/v2.4/":       `<html><body><a href="/latest/a.html">a</a><a href="/contact">contact</a><img src="/latest/a.png"></body></html>`,
+		"/v2.4/a.html": "<html><body>a</body></html>",
+		"/v2.4/a.png":  "png",
+	})
+	host := mustParseURL(t, srv.URL).Host
+
+	d, err := buildTestDocset(t, Config{
+		URL:   srv.URL + "/v2.4/",
+		Depth: 2,
+		Rewrite: []RewriteRule{
+			{Pattern: `/latest/`, Replace: "/v2.4/"},
+			{Pattern: `^.*/contact$`, Replace: "mailto:a@example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	got := readDocument(t, d, host+"/v2.4/index.html")
+	for _, want := range []string{
+		`<a href="a.html">a</a>`,
+		`<img src="a.png"/>`,
+		// a link rewritten to a scheme which can not be downloaded is kept as is
+		`<a href="/contact">contact</a>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("the page does not contain %s:\n%s", want, got)
+		}
+	}
+	for _, p := range []string{"/v2.4/a.html", "/v2.4/a.png"} {
+		if !documentExists(d, host+p) {
+			t.Errorf("%s is not downloaded", p)
+		}
+	}
+}
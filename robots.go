@@ -0,0 +1,251 @@
+package dashdog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsRule is an allow or disallow line of robots.txt
+type robotsRule struct {
+	allow   bool
+	pattern string
+	regex   *regexp.Regexp
+}
+
+// newRobotsRule compiles pattern, `*` matches any sequence and a tailing `$` matches the end of the path
+func newRobotsRule(allow bool, pattern string) robotsRule {
+	expr := pattern
+	anchored := strings.HasSuffix(expr, "$")
+	expr = strings.TrimSuffix(expr, "$")
+	expr = "^" + strings.ReplaceAll(regexp.QuoteMeta(expr), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return robotsRule{
+		allow:   allow,
+		pattern: pattern,
+		regex:   regexp.MustCompile(expr),
+	}
+}
+
+func (r robotsRule) match(path string) bool {
+	return r.regex.MatchString(path)
+}
+
+// robotsRules is the group of robots.txt which applies to us
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// allowed reports whether path can be crawled, the longest matching rule wins and allow wins a tie
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil || path == "/robots.txt" {
+		return true
+	}
+
+	allow := true
+	length := -1
+	for _, rule := range r.rules {
+		if !rule.match(path) {
+			continue
+		}
+		if len(rule.pattern) > length || (len(rule.pattern) == length && rule.allow) {
+			allow = rule.allow
+			length = len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// disallowAll is used if the robots.txt is unreachable
+var disallowAll = &robotsRules{
+	rules: []robotsRule{newRobotsRule(false, "/")},
+}
+
+// parseRobots returns the rules of the group matching agent, or the group of `*` if no group matches
+func parseRobots(body []byte, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+	groups := make([]*group, 0)
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules.rules = append(current.rules.rules, newRobotsRule(key == "allow", value))
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	// merge all the groups of the same agent
+	var matched, wildcard *robotsRules
+	for _, g := range groups {
+		for _, a := range g.agents {
+			var dst **robotsRules
+			if a == agent {
+				dst = &matched
+			} else if a == "*" {
+				dst = &wildcard
+			} else {
+				continue
+			}
+			if *dst == nil {
+				*dst = &robotsRules{}
+			}
+			(*dst).rules = append((*dst).rules, g.rules.rules...)
+			if g.rules.crawlDelay > (*dst).crawlDelay {
+				(*dst).crawlDelay = g.rules.crawlDelay
+			}
+			break
+		}
+	}
+
+	if matched != nil {
+		return matched
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// robotsAgent returns the product token of userAgent, e.g. `dashdog` of `dashdog/1.0 (+https://...)`
+func robotsAgent(userAgent string) string {
+	token, _, _ := strings.Cut(userAgent, " ")
+	token, _, _ = strings.Cut(token, "/")
+	return token
+}
+
+type robotsEntry struct {
+	once  sync.Once
+	rules *robotsRules
+}
+
+// robotsChecker fetches and caches the robots.txt of every host, it is safe for concurrent use
+type robotsChecker struct {
+	fetcher *fetcher
+	limiter *rateLimiter
+	agent   string
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+func newRobotsChecker(fetcher *fetcher, limiter *rateLimiter, userAgent string) *robotsChecker {
+	return &robotsChecker{
+		fetcher: fetcher,
+		limiter: limiter,
+		agent:   robotsAgent(userAgent),
+		entries: map[string]*robotsEntry{},
+	}
+}
+
+func (c *robotsChecker) rules(u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &robotsEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.rules = c.load(u)
+		if entry.rules.crawlDelay > 0 && c.limiter != nil {
+			c.limiter.limiter(u.Host).raiseMinDelay(entry.rules.crawlDelay)
+			slog.Debug("robots crawl delay", slog.String("host", u.Host), slog.Duration("delay", entry.rules.crawlDelay))
+		}
+	})
+	return entry.rules
+}
+
+func (c *robotsChecker) load(u *url.URL) *robotsRules {
+	ru := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	resp, err := c.fetcher.get(ru)
+	if err != nil {
+		slog.Warn("fetch robots.txt failed, allow all", slog.String("url", ru.String()), slog.String("err", fmt.Sprintf("%+v", err)))
+		return &robotsRules{}
+	}
+
+	switch {
+	case resp.StatusCode() == http.StatusOK:
+		slog.Debug("load robots.txt", slog.String("url", ru.String()))
+		return parseRobots(resp.Body(), c.agent)
+	case resp.StatusCode() >= http.StatusInternalServerError:
+		// the robots.txt is unreachable, take it as a complete disallow
+		slog.Warn("robots.txt unreachable, disallow all", slog.String("url", ru.String()), slog.Int("status", resp.StatusCode()))
+		return disallowAll
+	default:
+		// there is no robots.txt
+		return &robotsRules{}
+	}
+}
+
+// preload fetches the robots.txt of the hosts of urls, so their crawl delays apply from the first request
+func (c *robotsChecker) preload(urls []*url.URL) {
+	for _, u := range urls {
+		if isLocal(u) {
+			continue
+		}
+		c.rules(u)
+	}
+}
+
+// allowed reports whether the robots.txt of the host of u allows us to crawl u
+func (c *robotsChecker) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return c.rules(u).allowed(path)
+}
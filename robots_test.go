@@ -0,0 +1,183 @@
+package dashdog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRobotsAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		agent string
+		paths map[string]bool
+	}{
+		{
+			name:  "no rules",
+			body:  "",
+			agent: "dashdog",
+			paths: map[string]bool{"/": true, "/a": true},
+		},
+		{
+			name:  "disallow prefix",
+			body:  "User-agent: *\nDisallow: /private/\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/private/a": false, "/private/": false, "/private": true, "/public/a": true},
+		},
+		{
+			name:  "empty disallow allows all",
+			body:  "User-agent: *\nDisallow:\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/": true, "/a": true},
+		},
+		{
+			name:  "the longest rule wins",
+			body:  "User-agent: *\nDisallow: /docs/\nAllow: /docs/pkg/\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/docs/a": false, "/docs/pkg/a": true},
+		},
+		{
+			name:  "the longest rule wins in any order",
+			body:  "User-agent: *\nAllow: /docs/\nDisallow: /docs/internal/\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/docs/a": true, "/docs/internal/a": false},
+		},
+		{
+			name:  "allow wins a tie",
+			body:  "User-agent: *\nDisallow: /page\nAllow: /page\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/page": true},
+		},
+		{
+			name:  "wildcard",
+			body:  "User-agent: *\nDisallow: /*/edit\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a/edit": false, "/a/b/edit/c": false, "/edit": true},
+		},
+		{
+			name:  "end anchor",
+			body:  "User-agent: *\nDisallow: /*.pdf$\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a.pdf": false, "/a.pdf?x=1": true, "/a.pdf.html": true},
+		},
+		{
+			name:  "query",
+			body:  "User-agent: *\nDisallow: /*?print=\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a?print=1": false, "/a": true},
+		},
+		{
+			name:  "regexp chars are literal",
+			body:  "User-agent: *\nDisallow: /a.b\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a.b": false, "/axb": true},
+		},
+		{
+			name:  "robots.txt is always allowed",
+			body:  "User-agent: *\nDisallow: /\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/robots.txt": true, "/a": false},
+		},
+		{
+			name:  "our group wins the wildcard group",
+			body:  "User-agent: *\nDisallow: /\n\nUser-agent: dashdog\nDisallow: /private/\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a": true, "/private/a": false},
+		},
+		{
+			name:  "the user agent is case insensitive",
+			body:  "User-agent: DashDog\nDisallow: /a\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a": false},
+		},
+		{
+			name:  "the other groups do not apply",
+			body:  "User-agent: googlebot\nDisallow: /\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a": true},
+		},
+		{
+			name:  "the wildcard group applies if no group matches",
+			body:  "User-agent: googlebot\nDisallow: /\n\nUser-agent: *\nDisallow: /b\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a": true, "/b": false},
+		},
+		{
+			name:  "several agents in a group",
+			body:  "User-agent: googlebot\nUser-agent: dashdog\nDisallow: /a\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a": false, "/b": true},
+		},
+		{
+			name:  "the groups of the same agent are merged",
+			body:  "User-agent: dashdog\nDisallow: /a\n\nUser-agent: googlebot\nDisallow: /b\n\nUser-agent: dashdog\nDisallow: /c\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a": false, "/b": true, "/c": false},
+		},
+		{
+			name:  "comments and case of the keys",
+			body:  "# comment\nUSER-AGENT: * # all\nDISALLOW: /a # private\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a": false, "/b": true},
+		},
+		{
+			name:  "rules before any user agent are ignored",
+			body:  "Disallow: /a\nUser-agent: *\nDisallow: /b\n",
+			agent: "dashdog",
+			paths: map[string]bool{"/a": true, "/b": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots([]byte(tt.body), tt.agent)
+			for path, want := range tt.paths {
+				if got := rules.allowed(path); got != want {
+					t.Errorf("allowed(%s) = %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want time.Duration
+	}{
+		{name: "no delay", body: "User-agent: *\nDisallow: /a\n", want: 0},
+		{name: "seconds", body: "User-agent: *\nCrawl-delay: 2\n", want: 2 * time.Second},
+		{name: "fraction", body: "User-agent: *\nCrawl-delay: 0.5\n", want: 500 * time.Millisecond},
+		{name: "invalid", body: "User-agent: *\nCrawl-delay: soon\n", want: 0},
+		{name: "negative", body: "User-agent: *\nCrawl-delay: -1\n", want: 0},
+		{name: "our group", body: "User-agent: *\nCrawl-delay: 5\n\nUser-agent: dashdog\nCrawl-delay: 1\n", want: time.Second},
+		{name: "the other group", body: "User-agent: googlebot\nCrawl-delay: 5\n", want: 0},
+		{name: "the max of the merged groups", body: "User-agent: dashdog\nCrawl-delay: 1\n\nUser-agent: dashdog\nCrawl-delay: 3\n", want: 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRobots([]byte(tt.body), "dashdog").crawlDelay; got != tt.want {
+				t.Errorf("crawlDelay = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRobotsAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{userAgent: "dashdog/1.0 (+https://github.com/tenfyzhong/dashdog)", want: "dashdog"},
+		{userAgent: "dashdog", want: "dashdog"},
+		{userAgent: "MyBot (internal)", want: "MyBot"},
+	}
+
+	for _, tt := range tests {
+		if got := robotsAgent(tt.userAgent); got != tt.want {
+			t.Errorf("robotsAgent(%s) = %s, want %s", tt.userAgent, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package dashdog
+
+import (
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// crawlScope decides which links can be crawled as the sub pages, no matter where the crawl starts
+type crawlScope struct {
+	hosts    []string
+	prefixes []string
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+}
+
+// newCrawlScope returns nil if config is empty, the hosts are the hosts of the seeds if config.Hosts is empty
+func newCrawlScope(config Scope, seeds []crawlSeed) (*crawlScope, error) {
+	if len(config.Hosts) == 0 && len(config.PathPrefixes) == 0 && len(config.Include) == 0 && len(config.Exclude) == 0 {
+		return nil, nil
+	}
+
+	s := &crawlScope{
+		hosts:    config.Hosts,
+		prefixes: config.PathPrefixes,
+	}
+	if len(s.hosts) == 0 {
+		s.hosts = seedHosts(seeds)
+	}
+
+	var err error
+	s.include, err = compileRegexps(config.Include)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compileRegexps Scope.Include")
+	}
+	s.exclude, err = compileRegexps(config.Exclude)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compileRegexps Scope.Exclude")
+	}
+	return s, nil
+}
+
+// match reports whether u is in the scope, the regexes match the whole url
+func (s crawlScope) match(u *url.URL) bool {
+	if !matchHost(s.hosts, u) {
+		return false
+	}
+
+	if len(s.prefixes) > 0 {
+		found := false
+		for _, prefix := range s.prefixes {
+			if strings.HasPrefix(u.Path, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	str := u.String()
+	if len(s.include) > 0 && matchRegexps(s.include, str) == nil {
+		return false
+	}
+	if re := matchRegexps(s.exclude, str); re != nil {
+		slog.Debug("excluded by scope", slog.String("url", str), slog.String("pattern", re.String()))
+		return false
+	}
+	return true
+}
+
+func compileRegexps(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "regexp.Compile %s", expr)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matchRegexps returns the first regexp matches s, or nil if none matches
+func matchRegexps(res []*regexp.Regexp, s string) *regexp.Regexp {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return re
+		}
+	}
+	return nil
+}
+
+// inScope reports whether u linked from ourl can be crawled as a sub page.
+// Without a scope, only the sub paths of ourl on the same host, or all the local files, can be crawled.
+func (d Dash) inScope(ourl, u *url.URL) bool {
+	if d.scope == nil {
+		return ourl.Host == u.Host && (isLocal(u) || strings.HasPrefix(u.Path, ourl.Path))
+	}
+	return d.scope.match(u)
+}
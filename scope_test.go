@@ -0,0 +1,190 @@
+package dashdog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewCrawlScope(t *testing.T) {
+	seeds, _, _, err := newCrawlSeeds(Config{URLs: []Seed{{URL: "https://example.com/docs/"}, {URL: "https://api.example.com:8443/"}}})
+	if err != nil {
+		t.Fatalf("newCrawlSeeds: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		config    Scope
+		wantNil   bool
+		wantHosts []string
+		wantErr   bool
+	}{
+		{name: "empty", wantNil: true},
+		{name: "the hosts of the seeds", config: Scope{PathPrefixes: []string{"/docs/"}}, wantHosts: []string{"example.com", "api.example.com:8443"}},
+		{name: "hosts", config: Scope{Hosts: []string{"*.example.com"}}, wantHosts: []string{"*.example.com"}},
+		{name: "invalid include", config: Scope{Include: []string{"("}}, wantErr: true},
+		{name: "invalid exclude", config: Scope{Exclude: []string{"("}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newCrawlScope(tt.config, seeds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newCrawlScope() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (s == nil) != tt.wantNil {
+				t.Fatalf("newCrawlScope() = %+v, want nil %v", s, tt.wantNil)
+			}
+			if s != nil && strings.Join(s.hosts, " ") != strings.Join(tt.wantHosts, " ") {
+				t.Errorf("hosts = %v, want %v", s.hosts, tt.wantHosts)
+			}
+		})
+	}
+}
+
+func TestCrawlScope(t *testing.T) {
+	seeds, _, _, err := newCrawlSeeds(Config{URL: "https://example.com/docs/"})
+	if err != nil {
+		t.Fatalf("newCrawlSeeds: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config Scope
+		url    string
+		want   bool
+	}{
+		{name: "the host of the seed", config: Scope{PathPrefixes: []string{"/"}}, url: "https://example.com/blog/a.html", want: true},
+		{name: "not the host of the seed", config: Scope{PathPrefixes: []string{"/"}}, url: "https://cdn.example.com/a.html", want: false},
+		{name: "host", config: Scope{Hosts: []string{"cdn.example.com"}}, url: "https://cdn.example.com/a.html", want: true},
+		{name: "host is case insensitive", config: Scope{Hosts: []string{"CDN.example.com"}}, url: "https://cdn.Example.com/a.html", want: true},
+		{name: "the seed host is not added", config: Scope{Hosts: []string{"cdn.example.com"}}, url: "https://example.com/docs/a.html", want: false},
+		{name: "subdomain", config: Scope{Hosts: []string{"*.example.com"}}, url: "https://api.example.com/a.html", want: true},
+		{name: "subdomain does not match the domain", config: Scope{Hosts: []string{"*.example.com"}}, url: "https://example.com/a.html", want: false},
+		{name: "host with port", config: Scope{Hosts: []string{"example.com:8443"}}, url: "https://example.com:8443/a.html", want: true},
+		{name: "host without port", config: Scope{Hosts: []string{"example.com"}}, url: "https://example.com:8443/a.html", want: true},
+
+		{name: "prefix", config: Scope{PathPrefixes: []string{"/docs/", "/api/"}}, url: "https://example.com/api/a.html", want: true},
+		{name: "not a prefix", config: Scope{PathPrefixes: []string{"/docs/", "/api/"}}, url: "https://example.com/blog/a.html", want: false},
+		{name: "prefix is not a dir", config: Scope{PathPrefixes: []string{"/docs"}}, url: "https://example.com/docs-v2/a.html", want: true},
+		{name: "prefix is case sensitive", config: Scope{PathPrefixes: []string{"/docs/"}}, url: "https://example.com/Docs/a.html", want: false},
+
+		{name: "include", config: Scope{Include: []string{`\.html$`}}, url: "https://example.com/blog/a.html", want: true},
+		{name: "not include", config: Scope{Include: []string{`\.html$`}}, url: "https://example.com/blog/a.pdf", want: false},
+		{name: "one of the includes", config: Scope{Include: []string{`\.pdf$`, `\.html$`}}, url: "https://example.com/blog/a.html", want: true},
+		{name: "include matches the whole url", config: Scope{Include: []string{`^https://example\.com/docs/`}}, url: "https://example.com/docs/a.html", want: true},
+		{name: "include matches the query", config: Scope{Include: []string{`\?lang=go`}}, url: "https://example.com/docs/a.html?lang=go", want: true},
+		{name: "exclude", config: Scope{Exclude: []string{`/internal/`}}, url: "https://example.com/docs/internal/a.html", want: false},
+		{name: "not exclude", config: Scope{Exclude: []string{`/internal/`}}, url: "https://example.com/docs/a.html", want: true},
+		{name: "exclude wins", config: Scope{Include: []string{`/docs/`}, Exclude: []string{`/internal/`}}, url: "https://example.com/docs/internal/a.html", want: false},
+		{name: "prefix before include", config: Scope{PathPrefixes: []string{"/api/"}, Include: []string{`/docs/`}}, url: "https://example.com/docs/a.html", want: false},
+		{name: "host before include", config: Scope{Include: []string{`/docs/`}}, url: "https://other.com/docs/a.html", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newCrawlScope(tt.config, seeds)
+			if err != nil {
+				t.Fatalf("newCrawlScope: %v", err)
+			}
+			if got := s.match(mustParseURL(t, tt.url)); got != tt.want {
+				t.Errorf("match(%s) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope Scope
+		ourl  string
+		url   string
+		want  bool
+	}{
+		{name: "sub path", ourl: "https://example.com/docs/", url: "https://example.com/docs/pkg/a.html", want: true},
+		{name: "not a sub path", ourl: "https://example.com/docs/pkg/", url: "https://example.com/docs/a.html", want: false},
+		{name: "another host", ourl: "https://example.com/docs/", url: "https://cdn.example.com/docs/a.html", want: false},
+		{name: "local file", ourl: "file://localhost/guide/a.html", url: "file://localhost/api/b.html", want: true},
+		// the scope does not depend on the page linking the url
+		{name: "scope", scope: Scope{PathPrefixes: []string{"/docs/", "/api/"}}, ourl: "https://example.com/docs/pkg/", url: "https://example.com/api/a.html", want: true},
+		{name: "out of the scope", scope: Scope{PathPrefixes: []string{"/docs/"}}, ourl: "https://example.com/docs/pkg/", url: "https://example.com/blog/a.html", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seeds, _, _, err := newCrawlSeeds(Config{URL: "https://example.com/docs/"})
+			if err != nil {
+				t.Fatalf("newCrawlSeeds: %v", err)
+			}
+			s, err := newCrawlScope(tt.scope, seeds)
+			if err != nil {
+				t.Fatalf("newCrawlScope: %v", err)
+			}
+			d := Dash{scope: s}
+			if got := d.inScope(mustParseURL(t, tt.ourl), mustParseURL(t, tt.url)); got != tt.want {
+				t.Errorf("inScope(%s, %s) = %v, want %v", tt.ourl, tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeSubPathRegex(t *testing.T) {
+	other := newTestSite(t, map[string]string{"/docs/x.html": "<html><body>x</body></html>"})
+	srv := newTestSite(t, map[string]string{
+		"/docs/": `<html><body>
+<a href="/docs/a.html">a</a>
+<a href="/api/b.html">b</a>
+<a href="/api/internal/c.html">c</a>
+<a href="/blog/d.html">d</a>
+<a href="/api/e.txt">e</a>
+<a href="` + other.URL + `/docs/x.html">x</a>
+</body></html>`,
+		"/docs/a.html":         "<html><body>a</body></html>",
+		"/api/b.html":          "<html><body>b</body></html>",
+		"/api/internal/c.html": "<html><body>c</body></html>",
+		"/blog/d.html":         "<html><body>d</body></html>",
+		"/api/e.txt":           "e",
+	})
+	host := mustParseURL(t, srv.URL).Host
+
+	// a sub page must be in the scope and match the sub path regex
+	d, err := buildTestDocset(t, Config{
+		URL:          srv.URL + "/docs/",
+		Depth:        2,
+		SubPathRegex: `\.html$`,
+		Scope: Scope{
+			PathPrefixes: []string{"/docs/", "/api/"},
+			Exclude:      []string{`/internal/`},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	got := readDocument(t, d, host+"/docs/index.html")
+	tests := []struct {
+		path  string
+		link  string
+		local bool
+	}{
+		{path: "/docs/a.html", link: `<a href="a.html">a</a>`, local: true},
+		{path: "/api/b.html", link: `<a href="../api/b.html">b</a>`, local: true},
+		{path: "/api/internal/c.html", link: `<a href="` + srv.URL + `/api/internal/c.html">c</a>`},
+		{path: "/blog/d.html", link: `<a href="` + srv.URL + `/blog/d.html">d</a>`},
+		{path: "/api/e.txt", link: `<a href="` + srv.URL + `/api/e.txt">e</a>`},
+	}
+	for _, tt := range tests {
+		if !strings.Contains(got, tt.link) {
+			t.Errorf("the page does not contain %s:\n%s", tt.link, got)
+		}
+		if documentExists(d, host+tt.path) != tt.local {
+			t.Errorf("%s is downloaded %v, want %v", tt.path, !tt.local, tt.local)
+		}
+	}
+	if want := `<a href="` + other.URL + `/docs/x.html">x</a>`; !strings.Contains(got, want) {
+		t.Errorf("the page does not contain %s:\n%s", want, got)
+	}
+}
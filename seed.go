@@ -0,0 +1,116 @@
+package dashdog
+
+import (
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// crawlSeed is a page the crawl starts from
+type crawlSeed struct {
+	u      *url.URL
+	bundle string // the bundle name of the pages of the seed, it may be empty
+	depth  int
+}
+
+// newCrawlSeeds resolves the seeds of config, url is the first seed if it is set.
+// It returns the source dir of a local build besides the seeds, and the index of the seed for dashIndexFilePath.
+func newCrawlSeeds(config Config) ([]crawlSeed, string, int, error) {
+	seeds := make([]Seed, 0, len(config.URLs)+1)
+	if config.URL != "" || len(config.URLs) == 0 {
+		seeds = append(seeds, Seed{URL: config.URL})
+	}
+	seeds = append(seeds, config.URLs...)
+
+	crawlSeeds := make([]crawlSeed, 0, len(seeds))
+	sourceDir := ""
+	index := 0
+	indexSet := false
+	for i, seed := range seeds {
+		dir, rawURL, err := localSource(config.SourceDir, seed.URL)
+		if err != nil {
+			return nil, "", 0, errors.Wrapf(err, "localSource")
+		}
+		if dir != "" {
+			if sourceDir != "" && dir != sourceDir {
+				return nil, "", 0, errors.Errorf("the local seeds are in different dirs %s and %s, set the source_dir", sourceDir, dir)
+			}
+			sourceDir = dir
+			slog.Debug("local source", slog.String("dir", dir), slog.String("url", rawURL))
+		} else {
+			rawURL = seed.URL
+		}
+
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, "", 0, errors.Wrapf(err, "Parse %s", rawURL)
+		}
+		if !u.IsAbs() {
+			return nil, "", 0, errors.Wrapf(ErrUrlInvalid, "%s", rawURL)
+		}
+
+		depth := seed.Depth
+		if depth <= 0 {
+			depth = config.Depth
+		}
+		crawlSeeds = append(crawlSeeds, crawlSeed{
+			u:      normalizeURL(config.Normalize, u),
+			bundle: seed.Bundle,
+			depth:  depth,
+		})
+
+		if seed.Index {
+			if indexSet {
+				return nil, "", 0, errors.Errorf("more than one index seed: %s", seed.URL)
+			}
+			index = i
+			indexSet = true
+		}
+	}
+	return crawlSeeds, sourceDir, index, nil
+}
+
+// seedHosts returns the hosts of the seeds
+func seedHosts(seeds []crawlSeed) []string {
+	hosts := make([]string, 0, len(seeds))
+	for _, seed := range seeds {
+		hosts = append(hosts, seed.u.Host)
+	}
+	return hosts
+}
+
+// seedOf returns the seed u belongs to, it is the seed on the same host with the longest path prefix of u,
+// or nil if u is not under any seed
+func (d Dash) seedOf(u *url.URL) *crawlSeed {
+	var found *crawlSeed
+	for i := range d.crawlSeeds {
+		seed := &d.crawlSeeds[i]
+		if seed.u.Host != u.Host || !strings.HasPrefix(u.Path, seed.u.Path) {
+			continue
+		}
+		if found == nil || len(seed.u.Path) > len(found.u.Path) {
+			found = seed
+		}
+	}
+	return found
+}
+
+// inSeedSites reports whether u is on the same site as a seed
+func (d Dash) inSeedSites(u *url.URL) bool {
+	for _, seed := range d.crawlSeeds {
+		if seed.u.Scheme == u.Scheme && seed.u.Host == u.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// depthOf returns the max depth of the pages linked from u
+func (d Dash) depthOf(u *url.URL) int {
+	if seed := d.seedOf(u); seed != nil {
+		return seed.depth
+	}
+	return d.config.Depth
+}
@@ -0,0 +1,220 @@
+package dashdog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// maxSitemapDepth is how deep the sitemap index files can be nested
+const maxSitemapDepth = 3
+
+// sitemapBatchFactor times the concurrency is how many pages of the sitemap are queued ahead
+const sitemapBatchFactor = 4
+
+// sitemapDoc is a sitemap.xml or a sitemap index file, only one of URLs and Sitemaps is set
+type sitemapDoc struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// parseSitemap parses a sitemap.xml or a sitemap index file, it may be gzipped
+func parseSitemap(body []byte) (*sitemapDoc, error) {
+	if len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "gzip.NewReader")
+		}
+		defer r.Close()
+		body, err = io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "gunzip")
+		}
+	}
+
+	doc := &sitemapDoc{}
+	if err := xml.Unmarshal(body, doc); err != nil {
+		return nil, errors.Wrap(err, "xml.Unmarshal")
+	}
+	return doc, nil
+}
+
+// readSitemap reads the sitemap of loc, which is a url or a local file
+func (d *Dash) readSitemap(loc string) ([]byte, *url.URL, error) {
+	u, err := url.Parse(loc)
+	if err != nil || u.Scheme == "" || (u.Scheme == "file" && u.Host == "") {
+		name := os.ExpandEnv(loc)
+		if err == nil && u.Scheme == "file" {
+			name = filepath.FromSlash(u.Path)
+		}
+		body, err := os.ReadFile(name)
+		return body, nil, errors.Wrapf(err, "ReadFile %s", name)
+	}
+
+	resp, err := d.fetcher.get(u)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get %s", loc)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, nil, errors.Errorf("%s status %s", loc, resp.Status())
+	}
+	return resp.Body(), u, nil
+}
+
+// loadSitemap returns the page urls of the sitemap of loc, the sitemaps in a sitemap index file are loaded recursively
+func (d *Dash) loadSitemap(loc string, depth int, visited map[string]bool) ([]*url.URL, error) {
+	if visited[loc] {
+		return nil, nil
+	}
+	visited[loc] = true
+
+	body, base, err := d.readSitemap(loc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "readSitemap")
+	}
+	doc, err := parseSitemap(body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parseSitemap %s", loc)
+	}
+	slog.Debug("load sitemap", slog.String("loc", loc), slog.Int("urls", len(doc.URLs)), slog.Int("sitemaps", len(doc.Sitemaps)))
+
+	urls := make([]*url.URL, 0, len(doc.URLs))
+	for _, entry := range doc.URLs {
+		u, err := resolveSitemapLoc(base, entry.Loc)
+		if err != nil {
+			slog.Warn("invalid sitemap url", slog.String("sitemap", loc), slog.String("loc", entry.Loc))
+			continue
+		}
+		urls = append(urls, u)
+	}
+
+	for _, entry := range doc.Sitemaps {
+		if depth >= maxSitemapDepth {
+			slog.Warn("sitemap index is nested too deep", slog.String("sitemap", loc), slog.String("loc", entry.Loc))
+			break
+		}
+		u, err := resolveSitemapLoc(base, entry.Loc)
+		if err != nil {
+			slog.Warn("invalid sitemap url", slog.String("sitemap", loc), slog.String("loc", entry.Loc))
+			continue
+		}
+		// a broken sitemap in the index should not stop the others
+		sub, err := d.loadSitemap(u.String(), depth+1, visited)
+		if err != nil {
+			slog.Warn("load sitemap failed", slog.String("sitemap", u.String()), slog.String("err", fmt.Sprintf("%+v", err)))
+			continue
+		}
+		urls = append(urls, sub...)
+	}
+	return urls, nil
+}
+
+func resolveSitemapLoc(base *url.URL, loc string) (*url.URL, error) {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parse %s", loc)
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if !u.IsAbs() {
+		return nil, errors.Wrapf(ErrUrlInvalid, "%s", loc)
+	}
+	return u, nil
+}
+
+// sitemapSeeds returns the pages of the sitemap to crawl besides the seeds,
+// the pages out of the scope or the sites of the seeds, or not matching the sub path regex, or excluded, or disallowed by robots.txt are ignored
+func (d *Dash) sitemapSeeds() ([]*url.URL, error) {
+	if d.config.Sitemap == "" {
+		return nil, nil
+	}
+
+	urls, err := d.loadSitemap(d.config.Sitemap, 0, map[string]bool{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "loadSitemap %s", d.config.Sitemap)
+	}
+
+	seeds := make([]*url.URL, 0, len(urls))
+	seen := map[string]bool{}
+	for _, u := range urls {
+		rewritten, err := d.rewrite(u)
+		if err != nil {
+			// the url of a sitemap is a seed, it has no referrer
+			if ferr := d.fail(u, nil, nil, err); ferr != nil {
+				return nil, errors.Wrapf(ferr, "rewrite")
+			}
+			continue
+		}
+		u = d.normalize(rewritten)
+		key := fetchKey(u)
+		if seen[key] || d.seeds[key] {
+			continue
+		}
+		seen[key] = true
+
+		if (d.scope == nil && !d.inSeedSites(u)) || (d.scope != nil && !d.scope.match(u)) {
+			slog.Debug("sitemap url out of the scope", slog.String("url", u.String()))
+			continue
+		}
+		if !d.pathMatchRegex(u.Path) || d.excludedPage(u) || !d.robotsAllowed(u) {
+			continue
+		}
+		seeds = append(seeds, u)
+	}
+	slog.Info("sitemap", slog.String("sitemap", d.config.Sitemap), slog.Int("urls", len(urls)), slog.Int("seeds", len(seeds)))
+	return seeds, nil
+}
+
+// isSeed reports whether u is a seed or a page of the sitemap, a seed is always crawled at level 0
+func (d Dash) isSeed(u *url.URL) bool {
+	return d.seeds[fetchKey(u)]
+}
+
+// populateSeeds crawls the pages of the sitemap which are not reached from the seed,
+// a page of the sitemap may be gone, it is skipped
+func (d *Dash) populateSeeds(seeds []*url.URL) error {
+	// a large sitemap would flood the queue, only a few pages are queued ahead of the one populated
+	batch := sitemapBatchFactor * d.config.Concurrency
+	tasks := make([]*fetchTask, len(seeds))
+	submitted := 0
+	for i, u := range seeds {
+		for ; submitted < len(seeds) && submitted < i+batch; submitted++ {
+			tasks[submitted] = d.submit(seeds[submitted])
+		}
+
+		item, err := d.newFetchItem(u, 0, true, tasks[i])
+		if err != nil {
+			if ferr := d.fail(u, nil, nil, err); ferr != nil {
+				return errors.Wrapf(ferr, "newFetchItem")
+			}
+			continue
+		}
+		if item.resp.StatusCode() == http.StatusNotFound || item.resp.StatusCode() == http.StatusGone {
+			slog.Warn("sitemap page is gone", slog.String("url", u.String()), slog.Int("status", item.resp.StatusCode()))
+			d.state.finish(fetchKey(u))
+			continue
+		}
+
+		slog.Debug("populate seed", slog.String("item", item.String()))
+		if _, err := d.populateData(item); err != nil {
+			if ferr := d.fail(item.u, nil, item.resp, err); ferr != nil {
+				return errors.Wrapf(ferr, "populateData")
+			}
+		}
+	}
+	return nil
+}
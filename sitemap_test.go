@@ -0,0 +1,214 @@
+package dashdog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func gzipped(t *testing.T, s string) string {
+	t.Helper()
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	return b.String()
+}
+
+const testURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>https://example.com/docs/a.html</loc>
+    <lastmod>2024-01-02T15:04:05+00:00</lastmod>
+    <changefreq>weekly</changefreq>
+    <priority>0.8</priority>
+  </url>
+  <url>
+    <loc>https://example.com/docs/b.html</loc>
+    <lastmod>2024-01-02</lastmod>
+  </url>
+</urlset>`
+
+const testSitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap>
+    <loc>https://example.com/sitemap-1.xml</loc>
+    <lastmod>2024-01-02T15:04:05+00:00</lastmod>
+  </sitemap>
+  <sitemap>
+    <loc>https://example.com/sitemap-2.xml.gz</loc>
+  </sitemap>
+</sitemapindex>`
+
+func TestParseSitemap(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantURLs     []string
+		wantSitemaps []string
+		wantErr      bool
+	}{
+		{name: "urlset with lastmod", body: testURLSet, wantURLs: []string{"https://example.com/docs/a.html", "https://example.com/docs/b.html"}},
+		{name: "sitemap index with lastmod", body: testSitemapIndex, wantSitemaps: []string{"https://example.com/sitemap-1.xml", "https://example.com/sitemap-2.xml.gz"}},
+		{name: "gzipped urlset", body: gzipped(t, testURLSet), wantURLs: []string{"https://example.com/docs/a.html", "https://example.com/docs/b.html"}},
+		{name: "gzipped sitemap index", body: gzipped(t, testSitemapIndex), wantSitemaps: []string{"https://example.com/sitemap-1.xml", "https://example.com/sitemap-2.xml.gz"}},
+		{name: "empty urlset", body: `<urlset></urlset>`},
+		{name: "invalid xml", body: `<urlset><url>`, wantErr: true},
+		{name: "invalid gzip", body: "\x1f\x8b not gzip", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseSitemap([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSitemap() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			urls := make([]string, 0, len(doc.URLs))
+			for _, entry := range doc.URLs {
+				urls = append(urls, entry.Loc)
+			}
+			sitemaps := make([]string, 0, len(doc.Sitemaps))
+			for _, entry := range doc.Sitemaps {
+				sitemaps = append(sitemaps, entry.Loc)
+			}
+			if fmt.Sprint(urls) != fmt.Sprint(tt.wantURLs) {
+				t.Errorf("urls = %v, want %v", urls, tt.wantURLs)
+			}
+			if fmt.Sprint(sitemaps) != fmt.Sprint(tt.wantSitemaps) {
+				t.Errorf("sitemaps = %v, want %v", sitemaps, tt.wantSitemaps)
+			}
+		})
+	}
+}
+
+func TestLoadSitemap(t *testing.T) {
+	srv := newTestSite(t, map[string]string{
+		"/sitemap_index.xml": `<sitemapindex>
+  <sitemap><loc>/sitemap-1.xml</loc><lastmod>2024-01-02</lastmod></sitemap>
+  <sitemap><loc>sitemap-2.xml.gz</loc></sitemap>
+  <sitemap><loc>/missing.xml</loc></sitemap>
+  <sitemap><loc>/sitemap_index.xml</loc></sitemap>
+</sitemapindex>`,
+		"/sitemap-1.xml":    `<urlset><url><loc>/docs/a.html</loc><lastmod>2024-01-02</lastmod></url><url><loc>docs/b.html</loc></url></urlset>`,
+		"/sitemap-2.xml.gz": gzipped(t, `<urlset><url><loc>/docs/c.html</loc></url></urlset>`),
+	})
+	local := filepath.Join(t.TempDir(), "sitemap.xml")
+	if err := os.WriteFile(local, []byte(`<urlset><url><loc>`+srv.URL+`/docs/d.html</loc></url><url><loc>relative.html</loc></url></urlset>`), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		loc     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			// the broken sitemap is skipped, the index itself is loaded only once
+			name: "sitemap index",
+			loc:  srv.URL + "/sitemap_index.xml",
+			want: []string{srv.URL + "/docs/a.html", srv.URL + "/docs/b.html", srv.URL + "/docs/c.html"},
+		},
+		{name: "gzipped sitemap", loc: srv.URL + "/sitemap-2.xml.gz", want: []string{srv.URL + "/docs/c.html"}},
+		// a relative url in a local file can not be resolved
+		{name: "local file", loc: local, want: []string{srv.URL + "/docs/d.html"}},
+		{name: "file url", loc: "file://" + filepath.ToSlash(local), want: []string{srv.URL + "/docs/d.html"}},
+		{name: "missing", loc: srv.URL + "/missing.xml", wantErr: true},
+		{name: "missing file", loc: filepath.Join(t.TempDir(), "sitemap.xml"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDash(t, srv.URL+"/docs/")
+			urls, err := d.loadSitemap(tt.loc, 0, map[string]bool{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSitemap() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := make([]string, 0, len(urls))
+			for _, u := range urls {
+				got = append(got, u.String())
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("loadSitemap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSitemapSeedsBatch(t *testing.T) {
+	const pages = 50
+	files := map[string]string{"/docs/": "<html><body>docs</body></html>"}
+	var sitemap strings.Builder
+	sitemap.WriteString("<urlset>")
+	for i := 0; i < pages; i++ {
+		p := fmt.Sprintf("/docs/%d.html", i)
+		files[p] = "<html><body>page</body></html>"
+		fmt.Fprintf(&sitemap, "<url><loc>%s</loc></url>", p)
+	}
+	sitemap.WriteString("</urlset>")
+	files["/sitemap.xml"] = sitemap.String()
+
+	// the longest queue of the fetcher seen by the server
+	var (
+		mu       sync.Mutex
+		d        *Dash
+		maxQueue int
+	)
+	site := testSiteHandler(files)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if d != nil {
+			d.fetcher.mu.Lock()
+			maxQueue = max(maxQueue, len(d.fetcher.queue))
+			d.fetcher.mu.Unlock()
+		}
+		mu.Unlock()
+		site.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	config := Config{
+		URL:          srv.URL + "/docs/",
+		Path:         t.TempDir(),
+		Name:         "test",
+		IgnoreRobots: true,
+		Concurrency:  2,
+		Sitemap:      srv.URL + "/sitemap.xml",
+	}
+	dash, err := NewDash(config)
+	if err != nil {
+		t.Fatalf("NewDash: %v", err)
+	}
+	mu.Lock()
+	d = dash
+	mu.Unlock()
+	if err := d.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	host := mustParseURL(t, srv.URL).Host
+	for i := 0; i < pages; i++ {
+		if p := fmt.Sprintf("%s/docs/%d.html", host, i); !documentExists(d, p) {
+			t.Errorf("%s is not downloaded", p)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if batch := sitemapBatchFactor * config.Concurrency; maxQueue > batch {
+		t.Errorf("%d urls are queued, want %d at most", maxQueue, batch)
+	}
+}
@@ -0,0 +1,127 @@
+package dashdog
+
+import (
+	"log/slog"
+	"net/url"
+
+	css "github.com/andybalholm/cascadia"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// srcsetAttrs are the attrs whose value is a list of image candidates
+var srcsetAttrs = map[string]bool{
+	"srcset":      true,
+	"data-srcset": true,
+}
+
+// lazyAttrs are the attrs of the lazy-loading images promoted to the attrs the browser loads
+var lazyAttrs = map[string]string{
+	"data-src":    "src",
+	"data-srcset": "srcset",
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// srcsetRefs returns the urls of the image candidates of a srcset value in order,
+// e.g. `a.png 1x, b.png 2x` or `a.png 480w, b.png 800w`
+func srcsetRefs(val string) []textRef {
+	refs := make([]textRef, 0)
+	i := 0
+	for i < len(val) {
+		for i < len(val) && (isSpace(val[i]) || val[i] == ',') {
+			i++
+		}
+
+		start := i
+		for i < len(val) && !isSpace(val[i]) {
+			i++
+		}
+		// the trailing commas of the url separate the candidates
+		end := i
+		for end > start && val[end-1] == ',' {
+			end--
+		}
+		if end > start {
+			refs = append(refs, textRef{
+				start: start,
+				end:   end,
+				val:   val[start:end],
+				quote: textQuoteNone,
+			})
+		}
+		if end < i {
+			continue
+		}
+
+		// skip the descriptors
+		depth := 0
+		for i < len(val) {
+			switch val[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if val[i] == ',' && depth <= 0 {
+				break
+			}
+			i++
+		}
+	}
+	return refs
+}
+
+// rewriteSrcsets downloads the image candidates of the srcset attrs of doc and rewrites them to the relative paths from localPath
+func (d *Dash) rewriteSrcsets(ourl, base *url.URL, localPath string, doc *html.Node, level int) ([]childLink, error) {
+	children := make([]childLink, 0)
+	for _, node := range css.MustCompile("*[srcset],*[data-srcset]").MatchAll(doc) {
+		for i, attr := range node.Attr {
+			if !srcsetAttrs[attr.Key] {
+				continue
+			}
+			rewritten, srcsetChildren, err := d.rewriteTextRefs(ourl, base, localPath, attr.Val, srcsetRefs(attr.Val), level)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rewriteTextRefs")
+			}
+			node.Attr[i].Val = rewritten
+			children = append(children, srcsetChildren...)
+		}
+	}
+	return children, nil
+}
+
+// promoteLazyAttrs sets src and srcset to the values of data-src and data-srcset of the lazy elements,
+// so the lazy-loading images render without the javascript of the site
+func (d Dash) promoteLazyAttrs(doc *html.Node) {
+	for _, node := range css.MustCompile("*[data-src],*[data-srcset]").MatchAll(doc) {
+		if !lazyElements[node.DataAtom] {
+			continue
+		}
+		attrs := make([]html.Attribute, 0, len(node.Attr))
+		promoted := map[string]string{}
+		for _, attr := range node.Attr {
+			if key, ok := lazyAttrs[attr.Key]; ok {
+				promoted[key] = attr.Val
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+
+		for i, attr := range attrs {
+			if val, ok := promoted[attr.Key]; ok {
+				attrs[i].Val = val
+				delete(promoted, attr.Key)
+			}
+		}
+		for _, key := range []string{"src", "srcset"} {
+			if val, ok := promoted[key]; ok {
+				attrs = append(attrs, html.Attribute{Key: key, Val: val})
+			}
+		}
+		node.Attr = attrs
+		slog.Debug("promote lazy attrs", slog.Any("node", anyJson(node)))
+	}
+}
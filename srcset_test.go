@@ -0,0 +1,49 @@
+package dashdog
+
+import "testing"
+
+func TestSrcsetRefs(t *testing.T) {
+	tests := []struct {
+		name string
+		val  string
+		want []string
+	}{
+		{name: "empty", val: "", want: []string{}},
+		{name: "spaces only", val: " \n\t", want: []string{}},
+		{name: "one url", val: "a.png", want: []string{"a.png"}},
+		{name: "x descriptors", val: "a.png 1x, b.png 2x", want: []string{"a.png", "b.png"}},
+		{name: "w descriptors", val: "a.png 480w, b.png 800w", want: []string{"a.png", "b.png"}},
+		{name: "fractional x descriptor", val: "a.png 1.5x,b.png 2x", want: []string{"a.png", "b.png"}},
+		{name: "no space after the comma", val: "a.png 480w,b.png 800w", want: []string{"a.png", "b.png"}},
+		{name: "no descriptor", val: "a.png, b.png 2x", want: []string{"a.png", "b.png"}},
+		{name: "no descriptors", val: "a.png,b.png", want: []string{"a.png,b.png"}},
+		{name: "comma in the url", val: "img.php?w=100,h=200 1x, img.php?w=200,h=400 2x", want: []string{"img.php?w=100,h=200", "img.php?w=200,h=400"}},
+		{name: "data url", val: "data:image/png;base64,AAAA 1x, b.png 2x", want: []string{"data:image/png;base64,AAAA", "b.png"}},
+		{name: "several trailing commas", val: "a.png,,, b.png", want: []string{"a.png", "b.png"}},
+		{name: "leading commas", val: ", ,a.png 1x", want: []string{"a.png"}},
+		{name: "newlines", val: "\n  a.png 1x,\n  b.png 2x\n", want: []string{"a.png", "b.png"}},
+		{name: "width and height descriptors", val: "a.png 100w 50h, b.png 200w 100h", want: []string{"a.png", "b.png"}},
+		{name: "parentheses in the descriptors", val: "a.png (1, 2) 1x, b.png 2x", want: []string{"a.png", "b.png"}},
+		{name: "absolute urls", val: "https://cdn.example.com/a.png 1x, //cdn.example.com/b.png 2x", want: []string{"https://cdn.example.com/a.png", "//cdn.example.com/b.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := srcsetRefs(tt.val)
+			if len(got) != len(tt.want) {
+				t.Fatalf("srcsetRefs(%q) = %+v, want %q", tt.val, got, tt.want)
+			}
+			for i, want := range tt.want {
+				if got[i].val != want {
+					t.Errorf("srcsetRefs(%q)[%d] = %q, want %q", tt.val, i, got[i].val, want)
+				}
+				if raw := tt.val[got[i].start:got[i].end]; raw != want {
+					t.Errorf("srcsetRefs(%q)[%d] raw = %q, want %q", tt.val, i, raw, want)
+				}
+				if got[i].quote != textQuoteNone {
+					t.Errorf("srcsetRefs(%q)[%d] quote = %v, want none", tt.val, i, got[i].quote)
+				}
+			}
+		})
+	}
+}
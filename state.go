@@ -0,0 +1,119 @@
+package dashdog
+
+import (
+	"sort"
+	"sync"
+)
+
+// crawlState records what a build has visited and collected, it is safe for concurrent use
+type crawlState struct {
+	mu         sync.Mutex
+	downloaded map[string]bool
+	refs       []*Reference
+	files      map[string]*fileRecord // keyed by the local path
+	pending    map[string]bool        // the urls discovered but not finished
+}
+
+func newCrawlState() *crawlState {
+	return &crawlState{
+		downloaded: map[string]bool{},
+		files:      map[string]*fileRecord{},
+		pending:    map[string]bool{},
+	}
+}
+
+// markDownloaded marks path as downloaded, it returns false if path has been marked before
+func (s *crawlState) markDownloaded(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.downloaded[path] {
+		return false
+	}
+	s.downloaded[path] = true
+	return true
+}
+
+func (s *crawlState) addRefs(refs ...*Reference) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refs = append(s.refs, refs...)
+}
+
+// references returns a copy of the collected references in the order they were added
+func (s *crawlState) references() []*Reference {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs := make([]*Reference, len(s.refs))
+	copy(refs, s.refs)
+	return refs
+}
+
+// addFile records the file written to localPath, it returns false if localPath has been recorded before
+func (s *crawlState) addFile(localPath string, record *fileRecord) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[localPath]; ok {
+		return false
+	}
+	s.files[localPath] = record
+	return true
+}
+
+func (s *crawlState) hasFile(localPath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.files[localPath]
+	return ok
+}
+
+// fileRecords returns a copy of the recorded files
+func (s *crawlState) fileRecords() map[string]*fileRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make(map[string]*fileRecord, len(s.files))
+	for k, v := range s.files {
+		files[k] = v
+	}
+	return files
+}
+
+func (s *crawlState) fileCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.files)
+}
+
+func (s *crawlState) addPending(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending[key] = true
+}
+
+// finish removes key from the pending urls
+func (s *crawlState) finish(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, key)
+}
+
+// pendingURLs returns the pending urls in order
+func (s *crawlState) pendingURLs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urls := make([]string, 0, len(s.pending))
+	for k := range s.pending {
+		urls = append(urls, k)
+	}
+	sort.Strings(urls)
+	return urls
+}
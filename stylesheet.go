@@ -0,0 +1,312 @@
+package dashdog
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	css "github.com/andybalholm/cascadia"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// cssRefPattern matches the comments, the url() and the @import of a stylesheet, the comments are matched to be skipped.
+// The groups are the double quoted, the single quoted and the unquoted url of url(), and the double quoted and the single quoted url of @import,
+// a backslash escapes the next char in all of them.
+var cssRefPattern = regexp.MustCompile(`(?is)/\*.*?\*/|url\(\s*(?:"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)'|((?:[^)"'\s\\]|\\.)*))\s*\)|@import\s+(?:"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)')`)
+
+// cssUnquotedGroup is the group of the unquoted url of url() in cssRefPattern
+const cssUnquotedGroup = 3
+
+// textQuote is how a url is written in a text
+type textQuote int
+
+const (
+	textQuoteNone      textQuote = iota // as is, e.g. an image candidate of a srcset attr
+	textQuoteCSSString                  // in a quoted css string, the quotes and the backslashes are escaped
+	textQuoteCSSURL                     // in an unquoted url(), it is quoted if it has the chars like spaces and parentheses
+)
+
+// textRef is a url referenced in a text, e.g. a stylesheet or a srcset attr
+type textRef struct {
+	start int    // the start of the url in the text, the quotes are not included
+	end   int    // the end of the url in the text
+	val   string // the url, the css escapes are decoded
+	quote textQuote
+}
+
+// textLink is a url of a text to download
+type textLink struct {
+	ref    textRef
+	u      *url.URL
+	task   *fetchTask // nil if the url is not downloaded
+	failed bool       // the url failed to rewrite, it is left online
+}
+
+// cssRefs returns the urls of url() and @import in text in order
+func cssRefs(text string) []textRef {
+	refs := make([]textRef, 0)
+	for _, m := range cssRefPattern.FindAllStringSubmatchIndex(text, -1) {
+		for g := 1; 2*g+1 < len(m); g++ {
+			start, end := m[2*g], m[2*g+1]
+			if start < 0 {
+				continue
+			}
+			quote := textQuoteCSSString
+			if g == cssUnquotedGroup {
+				quote = textQuoteCSSURL
+			}
+			refs = append(refs, textRef{
+				start: start,
+				end:   end,
+				val:   cssUnescape(text[start:end]),
+				quote: quote,
+			})
+			break
+		}
+	}
+	return refs
+}
+
+// cssUnescape decodes the backslash escapes of a css string or url(), e.g. `a\(1\).png` => `a(1).png` and `\26 b` => `&b`
+func cssUnescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+
+		// at most 6 hex digits of a code point, a whitespace after them is a part of the escape
+		j := i
+		for j < len(s) && j-i < 6 && isHexDigit(s[j]) {
+			j++
+		}
+		if j > i {
+			cp, _ := strconv.ParseUint(s[i:j], 16, 32)
+			r := rune(cp)
+			if r == 0 || !utf8.ValidRune(r) {
+				r = utf8.RuneError
+			}
+			b.WriteRune(r)
+			if j < len(s) && isSpace(s[j]) {
+				j++
+			}
+			i = j - 1
+			continue
+		}
+		if s[i] == '\n' {
+			// an escaped newline continues the string
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// cssEscapeString escapes val to write into a quoted css string, the escaped quotes are valid in both the double and the single quoted strings
+func cssEscapeString(val string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `'`, `\'`, "\n", `\a `).Replace(val)
+}
+
+// quoteText returns the url to write to a text as quote
+func quoteText(val string, quote textQuote) string {
+	switch quote {
+	case textQuoteCSSString:
+		return cssEscapeString(val)
+	case textQuoteCSSURL:
+		if strings.ContainsAny(val, " \t\n()'\"\\") {
+			return `"` + cssEscapeString(val) + `"`
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+// isStylesheet reports whether item is a stylesheet, its references are downloaded and rewritten
+func (i fetchItem) isStylesheet() bool {
+	return strings.Contains(strings.ToLower(i.resp.Header().Get("Content-Type")), "text/css")
+}
+
+// rewriteCSS downloads the urls referenced by the stylesheet text and rewrites them to the relative paths from localPath.
+// base is the url to resolve the references, referrer is the page or the stylesheet text comes from.
+// It returns the rewritten text and the resources fetched.
+func (d *Dash) rewriteCSS(referrer, base *url.URL, localPath, text string, level int) (string, []childLink, error) {
+	return d.rewriteTextRefs(referrer, base, localPath, text, cssRefs(text), level)
+}
+
+// rewriteTextRefs downloads the urls of refs of text as resources and rewrites them to the relative paths from localPath,
+// the urls can not be downloaded are rewritten to the online urls
+func (d *Dash) rewriteTextRefs(referrer, base *url.URL, localPath, text string, refs []textRef, level int) (string, []childLink, error) {
+	links := make([]*textLink, 0)
+	for _, ref := range refs {
+		val := strings.TrimSpace(ref.val)
+		if val == "" || strings.HasPrefix(val, "#") {
+			// the fragment only url refers to an svg element of the same document
+			continue
+		}
+
+		u, ok, err := resolveLink(base, val)
+		if err != nil {
+			slog.Warn("invalid url", slog.String("referrer", referrer.String()), slog.String("ref", val))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		rewritten, err := d.rewrite(u)
+		if err != nil {
+			if ferr := d.fail(u, referrer, nil, err); ferr != nil {
+				return "", nil, errors.Wrapf(ferr, "rewrite")
+			}
+			links = append(links, &textLink{ref: ref, u: u, failed: true})
+			continue
+		}
+		u = rewritten
+		if !downloadable(u) {
+			continue
+		}
+		u = d.normalize(u)
+
+		link := &textLink{
+			ref: ref,
+			u:   u,
+		}
+		if !d.excludedAsset(u) {
+			link.task = d.submit(u)
+		}
+		links = append(links, link)
+	}
+
+	children := make([]childLink, 0)
+	var b strings.Builder
+	last := 0
+	for _, link := range links {
+		val, child, err := d.fetchTextLink(link, referrer, localPath, level)
+		if err != nil {
+			return "", nil, err
+		}
+		if child != nil {
+			children = append(children, *child)
+		}
+		b.WriteString(text[last:link.ref.start])
+		b.WriteString(quoteText(val, link.ref.quote))
+		last = link.ref.end
+	}
+	b.WriteString(text[last:])
+	return b.String(), children, nil
+}
+
+// fetchTextLink downloads the url of link, it returns the url to write to the text and the resource fetched,
+// the url is the online one if it can not be downloaded
+func (d *Dash) fetchTextLink(link *textLink, referrer *url.URL, localPath string, level int) (string, *childLink, error) {
+	u := link.u
+	if link.failed {
+		return u.String(), &childLink{URL: u.String(), Failed: true}, nil
+	}
+	if link.task == nil {
+		return u.String(), nil, nil
+	}
+
+	item, err := d.newFetchItem(u, level, false, link.task)
+	if err != nil {
+		if ferr := d.fail(u, referrer, nil, err); ferr != nil {
+			return "", nil, errors.Wrapf(ferr, "newFetchItem")
+		}
+		d.state.finish(fetchKey(u))
+		return u.String(), &childLink{URL: u.String(), Failed: true}, nil
+	}
+
+	if item.resp.StatusCode() == http.StatusNotFound {
+		// a missing font or image does not break the page, it is only recorded in the keep going mode
+		slog.Error("populateData failed", slog.Any("item", item), slog.Int("status", item.resp.StatusCode()))
+		_ = d.fail(item.u, referrer, item.resp, ErrNotFound)
+		d.state.finish(fetchKey(u))
+		return u.String(), nil, nil
+	} else if item.resp.StatusCode() != http.StatusOK {
+		if ferr := d.fail(item.u, referrer, item.resp, errors.Errorf("%s status %s", u.String(), item.resp.Status())); ferr != nil {
+			return "", nil, ferr
+		}
+		d.state.finish(fetchKey(u))
+		return u.String(), &childLink{URL: u.String(), Failed: true}, nil
+	}
+
+	processed, err := d.populateData(item)
+	if err != nil {
+		if ferr := d.fail(item.u, referrer, item.resp, err); ferr != nil {
+			return "", nil, errors.Wrapf(ferr, "populateData")
+		}
+		d.state.finish(fetchKey(u))
+		return u.String(), &childLink{URL: u.String(), Failed: true}, nil
+	}
+	child := newChildLink(processed)
+	return processed.localURL(localPath), &child, nil
+}
+
+// processStylesheet downloads the references of the stylesheet item and saves it with the references rewritten
+func (d *Dash) processStylesheet(item *fetchItem, record *fileRecord) (*fetchItem, error) {
+	if d.state.hasFile(item.localPath()) {
+		return item, nil
+	}
+
+	text, children, err := d.rewriteCSS(item.u, item.fetched, item.localPath(), string(item.resp.Body()), item.level)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rewriteCSS %s", item.u.String())
+	}
+	record.Children = children
+
+	if err := d.saveFile(item.localPath(), []byte(text)); err != nil {
+		return nil, errors.Wrapf(err, "saveFile")
+	}
+	slog.Debug("download stylesheet", slog.String("localPath", item.localPath()), slog.String("url", item.u.String()))
+	d.state.addFile(item.localPath(), record)
+	d.tickCheckpoint()
+	return item, nil
+}
+
+// rewriteStyles downloads the references of the `<style>` blocks and the style attrs of doc
+// and rewrites them to the relative paths from localPath
+func (d *Dash) rewriteStyles(ourl, base *url.URL, localPath string, doc *html.Node, level int) ([]childLink, error) {
+	children := make([]childLink, 0)
+	for _, node := range css.MustCompile("style").MatchAll(doc) {
+		text := node.FirstChild
+		if text == nil || text.Type != html.TextNode {
+			continue
+		}
+		rewritten, styleChildren, err := d.rewriteCSS(ourl, base, localPath, text.Data, level)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rewriteCSS")
+		}
+		text.Data = rewritten
+		children = append(children, styleChildren...)
+	}
+
+	for _, node := range css.MustCompile("*[style]").MatchAll(doc) {
+		for i, attr := range node.Attr {
+			if attr.Key != "style" {
+				continue
+			}
+			rewritten, styleChildren, err := d.rewriteCSS(ourl, base, localPath, attr.Val, level)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rewriteCSS")
+			}
+			node.Attr[i].Val = rewritten
+			children = append(children, styleChildren...)
+		}
+	}
+	return children, nil
+}
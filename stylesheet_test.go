@@ -0,0 +1,180 @@
+package dashdog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSSRefs(t *testing.T) {
+	type ref struct {
+		raw   string // the text between start and end
+		val   string
+		quote textQuote
+	}
+	tests := []struct {
+		name string
+		text string
+		want []ref
+	}{
+		{name: "unquoted", text: `a { background: url(img/a.png) }`, want: []ref{{raw: "img/a.png", val: "img/a.png", quote: textQuoteCSSURL}}},
+		{name: "double quoted", text: `a { background: url("img/a b.png") }`, want: []ref{{raw: "img/a b.png", val: "img/a b.png", quote: textQuoteCSSString}}},
+		{name: "single quoted", text: `a { background: url('img/a.png') }`, want: []ref{{raw: "img/a.png", val: "img/a.png", quote: textQuoteCSSString}}},
+		{name: "spaces inside the parentheses", text: "a { background: url(  img/a.png\n) }", want: []ref{{raw: "img/a.png", val: "img/a.png", quote: textQuoteCSSURL}}},
+		{name: "upper case", text: `a { background: URL(a.png) }`, want: []ref{{raw: "a.png", val: "a.png", quote: textQuoteCSSURL}}},
+		{name: "empty", text: `a { background: url() }`, want: []ref{{raw: "", val: "", quote: textQuoteCSSURL}}},
+		{name: "escaped parentheses unquoted", text: `a { background: url(a\(1\).png) }`, want: []ref{{raw: `a\(1\).png`, val: "a(1).png", quote: textQuoteCSSURL}}},
+		{name: "escaped space unquoted", text: `a { background: url(a\ b.png) }`, want: []ref{{raw: `a\ b.png`, val: "a b.png", quote: textQuoteCSSURL}}},
+		{name: "escaped quote double quoted", text: `a { background: url("a\"b.png") }`, want: []ref{{raw: `a\"b.png`, val: `a"b.png`, quote: textQuoteCSSString}}},
+		{name: "escaped quote single quoted", text: `a { background: url('it\'s.png') }`, want: []ref{{raw: `it\'s.png`, val: "it's.png", quote: textQuoteCSSString}}},
+		{name: "hex escape", text: `a { background: url("a\26 b.png") }`, want: []ref{{raw: `a\26 b.png`, val: "a&b.png", quote: textQuoteCSSString}}},
+		{name: "import string", text: `@import "base.css";`, want: []ref{{raw: "base.css", val: "base.css", quote: textQuoteCSSString}}},
+		{name: "import single quoted string", text: `@import 'base.css' screen;`, want: []ref{{raw: "base.css", val: "base.css", quote: textQuoteCSSString}}},
+		{name: "import url", text: `@import url(base.css);`, want: []ref{{raw: "base.css", val: "base.css", quote: textQuoteCSSURL}}},
+		{name: "import quoted url", text: `@import url("base.css") print;`, want: []ref{{raw: "base.css", val: "base.css", quote: textQuoteCSSString}}},
+		{name: "comment", text: `/* url(a.png) @import "b.css"; */ a { background: url(c.png) }`, want: []ref{{raw: "c.png", val: "c.png", quote: textQuoteCSSURL}}},
+		{name: "multiline comment", text: "/*\nurl(a.png)\n*/", want: []ref{}},
+		{
+			name: "several urls in order",
+			text: `@font-face { src: url("f.woff2?v=1#iefix") format("woff2"), url(f.woff) format("woff") }`,
+			want: []ref{
+				{raw: "f.woff2?v=1#iefix", val: "f.woff2?v=1#iefix", quote: textQuoteCSSString},
+				{raw: "f.woff", val: "f.woff", quote: textQuoteCSSURL},
+			},
+		},
+		{name: "data url", text: `a { background: url(data:image/png;base64,AAAA) }`, want: []ref{{raw: "data:image/png;base64,AAAA", val: "data:image/png;base64,AAAA", quote: textQuoteCSSURL}}},
+		{name: "not a url function", text: `a { content: "url"; background: myurl }`, want: []ref{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cssRefs(tt.text)
+			if len(got) != len(tt.want) {
+				t.Fatalf("cssRefs() = %+v, want %+v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if raw := tt.text[got[i].start:got[i].end]; raw != want.raw {
+					t.Errorf("cssRefs()[%d] raw = %q, want %q", i, raw, want.raw)
+				}
+				if got[i].val != want.val {
+					t.Errorf("cssRefs()[%d] val = %q, want %q", i, got[i].val, want.val)
+				}
+				if got[i].quote != want.quote {
+					t.Errorf("cssRefs()[%d] quote = %v, want %v", i, got[i].quote, want.quote)
+				}
+			}
+		})
+	}
+}
+
+func TestCSSUnescape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "a.png", want: "a.png"},
+		{in: `a\(1\).png`, want: "a(1).png"},
+		{in: `a\"b`, want: `a"b`},
+		{in: `a\\b`, want: `a\b`},
+		{in: `\26 b`, want: "&b"},
+		{in: `\26b`, want: "ɫ"},
+		{in: `\000026b`, want: "&b"},
+		{in: `\e9t\E9`, want: "été"},
+		{in: `\0`, want: "�"},
+		{in: `\110000`, want: "�"},
+		{in: "a\\\nb", want: "ab"},
+		{in: `\é`, want: "é"},
+		{in: `a\`, want: `a\`},
+	}
+
+	for _, tt := range tests {
+		if got := cssUnescape(tt.in); got != tt.want {
+			t.Errorf("cssUnescape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteText(t *testing.T) {
+	tests := []struct {
+		val   string
+		quote textQuote
+		want  string
+	}{
+		{val: "../img/a.png", quote: textQuoteNone, want: "../img/a.png"},
+		{val: "it's (1).png", quote: textQuoteNone, want: "it's (1).png"},
+		{val: "../img/a.png", quote: textQuoteCSSString, want: "../img/a.png"},
+		{val: `it's "a"\b`, quote: textQuoteCSSString, want: `it\'s \"a\"\\b`},
+		{val: "a\nb", quote: textQuoteCSSString, want: `a\a b`},
+		{val: "../img/a.png", quote: textQuoteCSSURL, want: "../img/a.png"},
+		{val: "a (1).png", quote: textQuoteCSSURL, want: `"a (1).png"`},
+		{val: "it's.png", quote: textQuoteCSSURL, want: `"it\'s.png"`},
+	}
+
+	for _, tt := range tests {
+		if got := quoteText(tt.val, tt.quote); got != tt.want {
+			t.Errorf("quoteText(%q, %v) = %q, want %q", tt.val, tt.quote, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteCSS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/static/img/a.png", "/static/img/a(1).png", "/static/img/it's.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("png"))
+		case "/static/base.css":
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = w.Write([]byte("body { margin: 0 }"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	d := newTestDash(t, srv.URL+"/")
+	page := mustParseURL(t, srv.URL+"/docs/pkg")
+	host := page.Host
+
+	text := strings.Join([]string{
+		`@import "../static/base.css";`,
+		`/* url(img/commented.png) */`,
+		`.a { background: url(../static/img/a.png) }`,
+		`.b { background: url('../static/img/a\(1\).png') }`,
+		`.c { background: url(../static/img/a\(1\).png) }`,
+		`.d { background: url("../static/img/it\'s.png") }`,
+		`.e { background: url(data:image/png;base64,AAAA) }`,
+		`.f { filter: url(#shadow) }`,
+		`.g { background: url(../static/img/missing.png) }`,
+	}, "\n")
+	// the escaped urls are decoded to download, the relative links are percent-encoded
+	want := strings.Join([]string{
+		`@import "../static/base.css";`,
+		`/* url(img/commented.png) */`,
+		`.a { background: url(../static/img/a.png) }`,
+		`.b { background: url('../static/img/a%281%29.png') }`,
+		`.c { background: url(../static/img/a%281%29.png) }`,
+		`.d { background: url("../static/img/it%27s.png") }`,
+		`.e { background: url(data:image/png;base64,AAAA) }`,
+		`.f { filter: url(#shadow) }`,
+		`.g { background: url(` + srv.URL + `/static/img/missing.png) }`,
+	}, "\n")
+
+	got, children, err := d.rewriteCSS(page, page, host+"/docs/pkg.html", text, 0)
+	if err != nil {
+		t.Fatalf("rewriteCSS() err = %v", err)
+	}
+	if got != want {
+		t.Errorf("rewriteCSS() =\n%s\nwant\n%s", got, want)
+	}
+	// a(1).png is linked twice but written once, the missing image is not a child
+	for _, localPath := range []string{host + "/static/base.css", host + "/static/img/a.png", host + "/static/img/a(1).png", host + "/static/img/it's.png"} {
+		if !d.state.hasFile(localPath) {
+			t.Errorf("%s is not recorded", localPath)
+		}
+	}
+	if len(children) != 5 {
+		t.Errorf("rewriteCSS() children = %+v, want 5", children)
+	}
+}
@@ -0,0 +1,77 @@
+package dashdog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"os"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+// setTransport configures the proxy, the tls and the timeout of client
+func setTransport(client *resty.Client, config HTTP) error {
+	if config.Proxy != "" {
+		proxy := os.ExpandEnv(config.Proxy)
+		client.SetProxy(proxy)
+		if client.IsProxySet() {
+			slog.Debug("set proxy", slog.String("proxy", proxy))
+		} else {
+			return errors.Errorf("invalid proxy %s", proxy)
+		}
+	}
+
+	if len(config.CACerts) > 0 || config.ClientCert != "" {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return errors.Wrapf(err, "newTLSConfig")
+		}
+		client.SetTLSClientConfig(tlsConfig)
+	}
+
+	if config.Timeout > 0 {
+		client.SetTimeout(config.Timeout)
+	}
+	return nil
+}
+
+// newTLSConfig trusts the extra CA certificates besides the system ones, and loads the client certificate for mTLS
+func newTLSConfig(config HTTP) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if len(config.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			slog.Warn("load system cert pool failed, only trust the extra CA certificates", slog.Any("err", err))
+			pool = x509.NewCertPool()
+		}
+		for _, file := range config.CACerts {
+			file = os.ExpandEnv(file)
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "ReadFile %s", file)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.Errorf("no certificate in %s", file)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ClientCert != "" {
+		certFile := os.ExpandEnv(config.ClientCert)
+		keyFile := os.ExpandEnv(config.ClientKey)
+		if keyFile == "" {
+			// the key may be in the same PEM file
+			keyFile = certFile
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "LoadX509KeyPair %s %s", certFile, keyFile)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -5,4 +5,8 @@ import "errors"
 var (
 	ErrUrlInvalid = errors.New("url is invalid")
 	ErrNotFound   = errors.New("not found")
+	ErrNotCached  = errors.New("not cached")
+
+	ErrTooManyFailures = errors.New("too many failures")
+	ErrBrokenLinks     = errors.New("broken links")
 )